@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	ErrMissingSignature = errors.New("signature required")
+	ErrUnknownPartner   = errors.New("unknown partner")
+	ErrStaleTimestamp   = errors.New("request timestamp too old or in the future")
+	ErrBadSignature     = errors.New("invalid signature")
+	ErrReplayedNonce    = errors.New("nonce already used")
+)
+
+const maxNonceLength = 128
+
+// SignedRequest carries the signature fields a partner sends with a session request.
+type SignedRequest struct {
+	PartnerID  string
+	CustomerID int
+	Timestamp  string // unix 秒
+	Nonce      string
+	Signature  string // hex 编码的 HMAC-SHA256
+}
+
+// Sign returns the signature of a session request, HMAC-SHA256 over
+// "<customerID>\n<timestamp>\n<nonce>" keyed with the partner secret.
+func Sign(secret string, customerID int, timestamp string, nonce string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d\n%s\n%s", customerID, timestamp, nonce)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verifier checks partner signatures and remembers nonces so a signed request
+// cannot be replayed while its timestamp is still accepted.
+type Verifier struct {
+	secrets   map[string]string // partnerId -> shared secret
+	maxSkew   time.Duration
+	mu        sync.Mutex
+	nonces    map[string]time.Time // partnerId + nonce -> 可以忘记的时间
+	lastPrune time.Time
+	now       func() time.Time
+}
+
+func NewVerifier(secrets map[string]string, maxSkew time.Duration) *Verifier {
+	return &Verifier{
+		secrets: secrets,
+		maxSkew: maxSkew,
+		nonces:  make(map[string]time.Time),
+		now:     time.Now,
+	}
+}
+
+// LoadPartners reads a JSON object mapping partner IDs to their shared secrets.
+func LoadPartners(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var secrets map[string]string
+	if err := json.Unmarshal(data, &secrets); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	for partner, secret := range secrets {
+		if secret == "" {
+			return nil, fmt.Errorf("partner %s has an empty secret", partner)
+		}
+	}
+	return secrets, nil
+}
+
+func (v *Verifier) Verify(req SignedRequest) error {
+	if req.PartnerID == "" || req.Timestamp == "" || req.Nonce == "" || req.Signature == "" {
+		return ErrMissingSignature
+	}
+	if len(req.Nonce) > maxNonceLength {
+		return ErrBadSignature
+	}
+	secret, ok := v.secrets[req.PartnerID]
+	if !ok {
+		return ErrUnknownPartner
+	}
+	seconds, err := strconv.ParseInt(req.Timestamp, 10, 64)
+	if err != nil {
+		return ErrStaleTimestamp
+	}
+	timestamp := time.Unix(seconds, 0)
+	now := v.now()
+	if timestamp.Before(now.Add(-v.maxSkew)) || timestamp.After(now.Add(v.maxSkew)) {
+		return ErrStaleTimestamp
+	}
+	expected := Sign(secret, req.CustomerID, req.Timestamp, req.Nonce)
+	if !hmac.Equal([]byte(expected), []byte(req.Signature)) {
+		return ErrBadSignature
+	}
+
+	// 签名正确之后才记录 nonce，避免别人用无效请求占用 nonce
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.prune(now)
+	key := req.PartnerID + "\n" + req.Nonce
+	if _, used := v.nonces[key]; used {
+		return ErrReplayedNonce
+	}
+	v.nonces[key] = timestamp.Add(v.maxSkew)
+	return nil
+}
+
+// prune forgets nonces whose timestamp can no longer pass the skew check.
+// It must be called with v.mu held.
+func (v *Verifier) prune(now time.Time) {
+	if now.Sub(v.lastPrune) < v.maxSkew {
+		return
+	}
+	for key, forgetAt := range v.nonces {
+		if now.After(forgetAt) {
+			delete(v.nonces, key)
+		}
+	}
+	v.lastPrune = now
+}
@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	now := time.Now()
+	verifier := NewVerifier(map[string]string{"partner": "secret"}, time.Minute)
+	verifier.now = func() time.Time { return now }
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	signed := SignedRequest{
+		PartnerID:  "partner",
+		CustomerID: 7,
+		Timestamp:  timestamp,
+		Nonce:      "n1",
+		Signature:  Sign("secret", 7, timestamp, "n1"),
+	}
+
+	if err := verifier.Verify(signed); err != nil {
+		t.Fatalf("Expected valid signature, got %v", err)
+	}
+	if err := verifier.Verify(signed); err != ErrReplayedNonce {
+		t.Errorf("Expected replay to be rejected, got %v", err)
+	}
+
+	other := signed
+	other.Nonce = "n2"
+	other.CustomerID = 8
+	if err := verifier.Verify(other); err != ErrBadSignature {
+		t.Errorf("Expected signature for another customer to be rejected, got %v", err)
+	}
+
+	stale := strconv.FormatInt(now.Add(-2*time.Minute).Unix(), 10)
+	old := SignedRequest{PartnerID: "partner", CustomerID: 7, Timestamp: stale, Nonce: "n3", Signature: Sign("secret", 7, stale, "n3")}
+	if err := verifier.Verify(old); err != ErrStaleTimestamp {
+		t.Errorf("Expected stale timestamp to be rejected, got %v", err)
+	}
+
+	unknown := signed
+	unknown.PartnerID = "nobody"
+	if err := verifier.Verify(unknown); err != ErrUnknownPartner {
+		t.Errorf("Expected unknown partner to be rejected, got %v", err)
+	}
+	if err := verifier.Verify(SignedRequest{CustomerID: 7}); err != ErrMissingSignature {
+		t.Errorf("Expected missing signature to be rejected, got %v", err)
+	}
+
+	// 超过时间窗口之后 nonce 会被清理
+	now = now.Add(3 * time.Minute)
+	verifier.Verify(SignedRequest{PartnerID: "partner", Timestamp: "0", Nonce: "x", Signature: "x"})
+	fresh := strconv.FormatInt(now.Unix(), 10)
+	verifier.Verify(SignedRequest{PartnerID: "partner", CustomerID: 1, Timestamp: fresh, Nonce: "n4", Signature: Sign("secret", 1, fresh, "n4")})
+	if _, ok := verifier.nonces["partner\nn1"]; ok {
+		t.Errorf("Expected expired nonce to be pruned")
+	}
+}
@@ -0,0 +1,175 @@
+package customer
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Status string
+
+const (
+	StatusActive       Status = "active"
+	StatusSuspended    Status = "suspended"
+	StatusSelfExcluded Status = "self_excluded"
+)
+
+var (
+	ErrUnknownCustomer = errors.New("unknown customer")
+	ErrSuspended       = errors.New("customer suspended")
+	ErrSelfExcluded    = errors.New("customer self-excluded")
+)
+
+type Customer struct {
+	ID     int    `json:"id"`
+	Status Status `json:"status"`
+}
+
+// Registry holds the customers allowed to get a session, loaded from a JSON or
+// CSV file and reloaded when the file changes.
+type Registry struct {
+	path      string
+	mu        sync.RWMutex
+	customers map[int]Customer
+	modTime   time.Time
+}
+
+// LoadRegistry reads path. Files ending in .csv hold "id,status" rows, an optional
+// header row included; anything else is a JSON array of customers.
+func LoadRegistry(path string) (*Registry, error) {
+	r := &Registry{path: path}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Check returns nil when the customer may be issued a session.
+func (r *Registry) Check(customerID int) error {
+	r.mu.RLock()
+	customer, ok := r.customers[customerID]
+	r.mu.RUnlock()
+	if !ok {
+		return ErrUnknownCustomer
+	}
+	switch customer.Status {
+	case StatusSuspended:
+		return ErrSuspended
+	case StatusSelfExcluded:
+		return ErrSelfExcluded
+	}
+	return nil
+}
+
+func (r *Registry) Lookup(customerID int) (Customer, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	customer, ok := r.customers[customerID]
+	return customer, ok
+}
+
+// Reload reads the file again. On error the customers loaded before are kept.
+func (r *Registry) Reload() error {
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(r.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var customers []Customer
+	if strings.EqualFold(filepath.Ext(r.path), ".csv") {
+		customers, err = readCSV(file)
+	} else {
+		err = json.NewDecoder(file).Decode(&customers)
+	}
+	if err != nil {
+		return fmt.Errorf("load customers from %s: %w", r.path, err)
+	}
+
+	byID := make(map[int]Customer, len(customers))
+	for _, customer := range customers {
+		if customer.Status == "" {
+			customer.Status = StatusActive
+		}
+		switch customer.Status {
+		case StatusActive, StatusSuspended, StatusSelfExcluded:
+		default:
+			return fmt.Errorf("customer %d has unknown status %q", customer.ID, customer.Status)
+		}
+		byID[customer.ID] = customer
+	}
+
+	r.mu.Lock()
+	r.customers = byID
+	r.modTime = info.ModTime()
+	r.mu.Unlock()
+	log.Printf("loaded %d customers from %s", len(byID), r.path)
+	return nil
+}
+
+// Watch reloads the file whenever its modification time changes, until ctx is cancelled.
+func (r *Registry) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			info, err := os.Stat(r.path)
+			if err != nil {
+				log.Printf("customer registry stat failed: %v", err)
+				continue
+			}
+			r.mu.RLock()
+			changed := !info.ModTime().Equal(r.modTime)
+			r.mu.RUnlock()
+			if !changed {
+				continue
+			}
+			if err := r.Reload(); err != nil {
+				log.Printf("customer registry reload failed: %v", err)
+			}
+		}
+	}
+}
+
+func readCSV(reader io.Reader) ([]Customer, error) {
+	csvReader := csv.NewReader(reader)
+	csvReader.FieldsPerRecord = -1 // status 可以省略
+	records, err := csvReader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	var customers []Customer
+	for i, record := range records {
+		id, err := strconv.Atoi(strings.TrimSpace(record[0]))
+		if err != nil {
+			if i == 0 {
+				continue // 表头
+			}
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		customer := Customer{ID: id}
+		if len(record) > 1 {
+			customer.Status = Status(strings.TrimSpace(record[1]))
+		}
+		customers = append(customers, customer)
+	}
+	return customers, nil
+}
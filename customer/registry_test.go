@@ -0,0 +1,58 @@
+package customer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadRegistry(t *testing.T) {
+	dir := t.TempDir()
+	csvPath := filepath.Join(dir, "customers.csv")
+	os.WriteFile(csvPath, []byte("id,status\n1,active\n2,suspended\n3,self_excluded\n4\n"), 0o600)
+	jsonPath := filepath.Join(dir, "customers.json")
+	os.WriteFile(jsonPath, []byte(`[{"id":1,"status":"active"},{"id":2,"status":"suspended"},{"id":3,"status":"self_excluded"},{"id":4}]`), 0o600)
+
+	for _, path := range []string{csvPath, jsonPath} {
+		registry, err := LoadRegistry(path)
+		if err != nil {
+			t.Fatalf("LoadRegistry(%s): %v", path, err)
+		}
+		cases := map[int]error{1: nil, 2: ErrSuspended, 3: ErrSelfExcluded, 4: nil, 5: ErrUnknownCustomer}
+		for id, expected := range cases {
+			if err := registry.Check(id); err != expected {
+				t.Errorf("%s: Check(%d) = %v, expected %v", filepath.Base(path), id, err, expected)
+			}
+		}
+	}
+
+	os.WriteFile(jsonPath, []byte(`[{"id":1,"status":"banned"}]`), 0o600)
+	if _, err := LoadRegistry(jsonPath); err == nil {
+		t.Errorf("Expected error for unknown status")
+	}
+}
+
+func TestRegistryWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "customers.json")
+	os.WriteFile(path, []byte(`[{"id":1}]`), 0o600)
+	registry, err := LoadRegistry(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go registry.Watch(ctx, 10*time.Millisecond)
+
+	// 修改文件后自动重新加载
+	os.WriteFile(path, []byte(`[{"id":1,"status":"suspended"}]`), 0o600)
+	os.Chtimes(path, time.Now(), time.Now().Add(time.Second))
+	deadline := time.Now().Add(2 * time.Second)
+	for registry.Check(1) != ErrSuspended {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected registry to reload the suspended customer")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,137 @@
+package handle
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"httpProject/stake"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// isAdmin reports whether the request carries the configured X-Admin-Token.
+func (app *App) isAdmin(r *http.Request) bool {
+	return app.adminToken != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Admin-Token")), []byte(app.adminToken)) == 1
+}
+
+// 处理 /admin/... ，需要 X-Admin-Token
+func (app *App) serveAdmin(w http.ResponseWriter, r *http.Request, pathParts []string) {
+	if !app.isAdmin(r) {
+		app.sendResponse(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	switch {
+	case len(pathParts) == 3 && r.Method == http.MethodPost && pathParts[1] == "offers":
+		app.handleCreateOffer(w, r, pathParts[2])
+	case len(pathParts) == 3 && r.Method == http.MethodGet && pathParts[1] == "offers":
+		app.handleGetOffer(w, r, pathParts[2])
+	case len(pathParts) == 4 && r.Method == http.MethodPost && pathParts[1] == "offers" && pathParts[3] == "state":
+		app.handleOfferState(w, r, pathParts[2])
+	case len(pathParts) == 4 && r.Method == http.MethodGet && pathParts[1] == "offers" && pathParts[3] == "stakes":
+		app.handleGetStakes(w, r, pathParts[2])
+	default:
+		app.sendResponse(w, http.StatusNotFound, "Not Found")
+	}
+}
+
+// 处理 POST /admin/offers/<betofferid>，body 是 stake.OfferConfig 的 JSON，省略的字段使用默认值
+func (app *App) handleCreateOffer(w http.ResponseWriter, r *http.Request, betOfferID string) {
+	ID, err := strconv.Atoi(betOfferID)
+	if err != nil {
+		app.sendResponse(w, http.StatusBadRequest, "Invalid input betOfferID")
+		return
+	}
+	cfg := app.StakeMap.Defaults
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		app.sendResponse(w, http.StatusBadRequest, "Invalid input body")
+		return
+	}
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &cfg); err != nil {
+			app.sendResponse(w, http.StatusBadRequest, "Invalid offer config")
+			return
+		}
+	}
+
+	offer, err := app.StakeMap.CreateOffer(ID, cfg)
+	if err != nil {
+		app.sendResponse(w, offerErrorStatus(err), err.Error())
+		return
+	}
+	app.sendJSON(w, http.StatusCreated, offer.Config)
+}
+
+// 处理 GET /admin/offers/<betofferid>
+func (app *App) handleGetOffer(w http.ResponseWriter, r *http.Request, betOfferID string) {
+	ID, err := strconv.Atoi(betOfferID)
+	if err != nil {
+		app.sendResponse(w, http.StatusBadRequest, "Invalid input betOfferID")
+		return
+	}
+	offer, ok := app.StakeMap.Offer(ID)
+	if !ok {
+		app.sendResponse(w, http.StatusNotFound, stake.ErrUnknownOffer.Error())
+		return
+	}
+	app.sendJSON(w, http.StatusOK, offer.Status())
+}
+
+// 处理 POST /admin/offers/<betofferid>/state，body 是新的状态：open、suspended、closed 或 settled
+func (app *App) handleOfferState(w http.ResponseWriter, r *http.Request, betOfferID string) {
+	ID, err := strconv.Atoi(betOfferID)
+	if err != nil {
+		app.sendResponse(w, http.StatusBadRequest, "Invalid input betOfferID")
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		app.sendResponse(w, http.StatusBadRequest, "Invalid input body")
+		return
+	}
+	state, err := stake.ParseOfferState(strings.TrimSpace(string(body)))
+	if err != nil {
+		app.sendResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	status, err := app.StakeMap.Transition(ID, state)
+	if err != nil {
+		app.sendResponse(w, offerErrorStatus(err), err.Error())
+		return
+	}
+	app.sendJSON(w, http.StatusOK, status)
+}
+
+// 处理 GET /admin/offers/<betofferid>/stakes?cursor=&limit=，返回全部下注记录，包含客户 ID
+func (app *App) handleGetStakes(w http.ResponseWriter, r *http.Request, betOfferID string) {
+	ID, err := strconv.Atoi(betOfferID)
+	if err != nil {
+		app.sendResponse(w, http.StatusBadRequest, "Invalid input betOfferID")
+		return
+	}
+	query := r.URL.Query()
+	cursor := 0
+	if value := query.Get("cursor"); value != "" {
+		cursor, err = strconv.Atoi(value)
+		if err != nil || cursor < 0 {
+			app.sendResponse(w, http.StatusBadRequest, "Invalid cursor")
+			return
+		}
+	}
+	limit := defaultStakePage
+	if value := query.Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > maxStakePage {
+			app.sendResponse(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+	}
+
+	stakes, next, _ := app.StakeMap.Stakes(ID, cursor, limit)
+	app.sendJSON(w, http.StatusOK, struct {
+		Stakes     []stake.Stake `json:"stakes"`
+		NextCursor int           `json:"next_cursor"` // 翻到最后一页后继续用它可以拿到之后的新下注
+	}{stakes, next})
+}
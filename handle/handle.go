@@ -2,30 +2,195 @@
 package handle
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"httpProject/auth"
+	"httpProject/customer"
 	"httpProject/session"
 	"httpProject/stake"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 )
 
 const (
-	port          = 9000
-	maxHighStakes = 20
+	port             = 9000
+	maxDeviceLength  = 64
+	defaultStakePage = 100
+	maxStakePage     = 1000
+	// GET /<customerid>/sessions 只显示 session key 的前几位
+	sessionKeyPrefixLength = 4
 )
 
 type App struct {
 	SessionManager *session.SessionManager
 	StakeMap       *stake.StakeMap
+	Customers      *customer.Registry // 为空时不检查客户
+	Signatures     *auth.Verifier     // 为空时获取 session 不需要签名
+	transports     []string
+	cookieSecure   bool
+	adminToken     string
+	rejections     map[stake.LimitReason]Rejection
 }
 
-func NewApp() *App {
-	return &App{
-		SessionManager: session.NewSessionManager(),
-		StakeMap:       stake.NewstakeMap(),
+type Config struct {
+	SnapshotPath       string        // 为空时不保存 session
+	SnapshotInterval   time.Duration // 也是 StoreFile 批量写入的间隔
+	StoreFile          string        // 设置后 session 保存在这个文件里，而不是只在内存中
+	CleanupInterval    time.Duration
+	SessionTTL         time.Duration
+	PolicyFile         string // 按客户等级配置 session 策略的 JSON 文件
+	TokenKeyFile       string // 设置后使用无状态的签名 token；撤销记录只在本进程内，多个实例之间不同步
+	SlidingExpiry      bool
+	MaxSessionLifetime time.Duration
+	MaxSessions        int // 每个客户最多的 session 数量
+	SessionBinding     session.BindingPolicy
+	CustomerFile       string        // 客户名单，JSON 或 CSV，为空时不检查
+	CustomerReload     time.Duration // 多久检查一次客户名单有没有变化
+	PartnerFile        string        // 合作方的签名密钥，为空时不要求签名
+	SignatureMaxSkew   time.Duration
+	SessionTransports  []string // 按顺序查找 session key，见 transport.go
+	CookieSecure       bool
+	AdminToken         string // 为空时关闭 /admin 接口
+	LeaderboardDepth   int    // 没有通过 admin 接口创建的 bet offer 的排行榜深度
+	StakeMerge         stake.MergePolicy
+	StakeTies          stake.TieBreak
+	AutoCreateOffers   bool // 第一次下注时自动创建 bet offer，关闭后需要先通过 admin 接口创建
+	// 没有通过 admin 接口创建的 bet offer 的下注限额，0 表示不限制
+	MinStake      int
+	MaxStake      int
+	MaxExposure   int
+	DailyExposure int    // 每个客户每天在所有 bet offer 上的累计下注上限
+	RejectionFile string // 超过限额时的响应，见 rejection.go
+}
+
+func DefaultConfig() Config {
+	return Config{
+		SnapshotInterval:   30 * time.Second,
+		CleanupInterval:    time.Minute,
+		CustomerReload:     5 * time.Second,
+		SessionTTL:         10 * time.Minute,
+		MaxSessionLifetime: time.Hour,
+		MaxSessions:        5,
+		SessionBinding:     session.DefaultBindingPolicy(),
+		SignatureMaxSkew:   5 * time.Minute,
+		SessionTransports:  []string{TransportHeader, TransportCookie, TransportQuery},
+		LeaderboardDepth:   stake.DefaultDepth,
+		StakeMerge:         stake.MergeMax,
+		StakeTies:          stake.TieFirstCome,
+		AutoCreateOffers:   true,
+		MaxStake:           1000000,
+	}
+}
+
+// validate rejects intervals the background loops in main cannot tick with.
+func (cfg Config) validate() error {
+	intervals := []struct {
+		name     string
+		value    time.Duration
+		required bool
+	}{
+		{"session cleanup interval", cfg.CleanupInterval, true},
+		{"session snapshot interval", cfg.SnapshotInterval, cfg.SnapshotPath != "" || cfg.StoreFile != ""},
+		{"customer reload interval", cfg.CustomerReload, cfg.CustomerFile != ""},
 	}
+	for _, interval := range intervals {
+		if interval.required && interval.value <= 0 {
+			return fmt.Errorf("%s must be positive, got %v", interval.name, interval.value)
+		}
+	}
+	return nil
+}
+
+func NewApp(cfg Config) (*App, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	opts := []session.Option{
+		session.WithTTL(cfg.SessionTTL),
+		session.WithMaxLifetime(cfg.MaxSessionLifetime),
+		session.WithMaxSessionsPerCustomer(cfg.MaxSessions),
+		session.WithBindingPolicy(cfg.SessionBinding),
+	}
+	if cfg.SlidingExpiry {
+		opts = append(opts, session.WithSlidingExpiry())
+	}
+	if cfg.StoreFile != "" {
+		store, err := session.NewFileStore(cfg.StoreFile)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, session.WithStore(store))
+	}
+	if cfg.TokenKeyFile != "" {
+		signer, err := session.LoadTokenSigner(cfg.TokenKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, session.WithTokenSigner(signer))
+	}
+	if cfg.PolicyFile != "" {
+		policies, err := session.LoadTierPolicies(cfg.PolicyFile)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, session.WithPolicyProvider(policies))
+	}
+	offerDefaults := stake.OfferConfig{
+		Depth:       cfg.LeaderboardDepth,
+		Merge:       cfg.StakeMerge,
+		Ties:        cfg.StakeTies,
+		MinStake:    cfg.MinStake,
+		MaxStake:    cfg.MaxStake,
+		MaxExposure: cfg.MaxExposure,
+	}
+	if err := offerDefaults.Validate(); err != nil {
+		return nil, err
+	}
+	app := &App{
+		SessionManager: session.NewSessionManager(opts...),
+		StakeMap:       stake.NewStakeMapWithDefaults(offerDefaults),
+		transports:     cfg.SessionTransports,
+		cookieSecure:   cfg.CookieSecure,
+		adminToken:     cfg.AdminToken,
+		rejections:     DefaultRejections(),
+	}
+	app.StakeMap.AutoCreate = cfg.AutoCreateOffers
+	app.StakeMap.DailyLimit = cfg.DailyExposure
+	if cfg.RejectionFile != "" {
+		rejections, err := LoadRejections(cfg.RejectionFile)
+		if err != nil {
+			return nil, err
+		}
+		app.rejections = rejections
+	}
+	if cfg.CustomerFile != "" {
+		registry, err := customer.LoadRegistry(cfg.CustomerFile)
+		if err != nil {
+			return nil, err
+		}
+		app.Customers = registry
+	}
+	if cfg.PartnerFile != "" {
+		secrets, err := auth.LoadPartners(cfg.PartnerFile)
+		if err != nil {
+			return nil, err
+		}
+		app.Signatures = auth.NewVerifier(secrets, cfg.SignatureMaxSkew)
+	}
+	if cfg.SnapshotPath != "" {
+		restored, err := app.SessionManager.Restore(cfg.SnapshotPath)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("restored %d sessions from %s", restored, cfg.SnapshotPath)
+	}
+	return app, nil
 }
 func (app *App) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	path := r.URL.Path
@@ -37,13 +202,30 @@ func (app *App) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if pathParts[0] == "admin" {
+		app.serveAdmin(w, r, pathParts)
+		return
+	}
+
 	switch {
+	case len(pathParts) == 2 && method == http.MethodGet && pathParts[0] == "session":
+		app.handleGetSessionInfo(w, r, pathParts[1])
+	case len(pathParts) == 2 && method == http.MethodDelete && pathParts[0] == "session":
+		app.handleRevokeSessionKey(w, r, pathParts[1])
+	case len(pathParts) == 2 && method == http.MethodDelete && strings.HasSuffix(path, "/session"):
+		app.handleRevokeSession(w, r, pathParts[0])
 	case len(pathParts) == 2 && method == http.MethodGet && strings.HasSuffix(path, "/session"):
 		app.handleGetSession(w, r, pathParts[0])
+	case len(pathParts) == 2 && method == http.MethodGet && strings.HasSuffix(path, "/sessions"):
+		app.handleListSessions(w, r, pathParts[0])
 	case len(pathParts) == 2 && method == http.MethodGet && strings.HasSuffix(path, "/highstakes"):
 		app.handleGetHighStakes(w, r, pathParts[0])
 	case len(pathParts) == 2 && method == http.MethodPost && strings.HasSuffix(path, "/stake"):
 		app.handlePostStake(w, r, pathParts[0])
+	case len(pathParts) == 2 && method == http.MethodDelete && strings.HasSuffix(path, "/stake"):
+		app.handleCancelStake(w, r, pathParts[0])
+	case len(pathParts) == 3 && method == http.MethodPost && strings.HasSuffix(path, "/session/refresh"):
+		app.handleRefreshSession(w, r, pathParts[0])
 	default:
 		app.sendResponse(w, http.StatusNotFound, "Not Found")
 	}
@@ -56,17 +238,206 @@ func (app *App) handleGetSession(w http.ResponseWriter, r *http.Request, custome
 		app.sendResponse(w, http.StatusBadRequest, "need input number")
 		return
 	}
-	session := app.SessionManager.GetSession(ID)
+	if app.Signatures != nil {
+		err := app.Signatures.Verify(auth.SignedRequest{
+			PartnerID:  r.Header.Get("X-Partner-ID"),
+			CustomerID: ID,
+			Timestamp:  r.Header.Get("X-Timestamp"),
+			Nonce:      r.Header.Get("X-Nonce"),
+			Signature:  r.Header.Get("X-Signature"),
+		})
+		if err != nil {
+			app.sendResponse(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+	}
+	if app.Customers != nil {
+		if err := app.Customers.Check(ID); err != nil {
+			app.sendResponse(w, customerErrorStatus(err), err.Error())
+			return
+		}
+	}
+	device := r.URL.Query().Get("device")
+	if len(device) > maxDeviceLength {
+		app.sendResponse(w, http.StatusBadRequest, "device label too long")
+		return
+	}
+	session := app.SessionManager.Issue(ID, session.IssueOptions{
+		Device:      device,
+		Fingerprint: fingerprint(r),
+	})
 	log.Printf(" get session  success in handle")
+	app.setSessionCookie(w, session)
+
+	app.sendResponse(w, http.StatusOK, session.SessionKey)
+}
+
+// 处理 GET /<customerid>/sessions，需要该客户的 session key
+func (app *App) handleListSessions(w http.ResponseWriter, r *http.Request, customerID string) {
+	ID, err := strconv.Atoi(customerID)
+	if err != nil {
+		app.sendResponse(w, http.StatusBadRequest, "need input number")
+		return
+	}
+	// 只有持有该客户有效 session 的请求才能看到所有 session
+	if !app.ownsCustomer(w, r, ID) {
+		return
+	}
+	sessions := app.SessionManager.Sessions(ID)
+	summaries := make([]sessionSummary, 0, len(sessions))
+	for _, session := range sessions {
+		summaries = append(summaries, summarize(session))
+	}
+	app.sendJSON(w, http.StatusOK, summaries)
+}
+
+// sessionSummary is what GET /<customerid>/sessions shows of each session. The keys of
+// the customer's other devices are never sent, only enough of them to tell them apart.
+type sessionSummary struct {
+	Device      string    `json:"device,omitempty"`
+	KeyPrefix   string    `json:"key_prefix"`
+	CreatedTime time.Time `json:"created_time"`
+	ExpiryTime  time.Time `json:"expiry_time"`
+}
+
+func summarize(session *session.Session) sessionSummary {
+	prefix := session.SessionKey
+	if len(prefix) > sessionKeyPrefixLength {
+		prefix = prefix[:sessionKeyPrefixLength]
+	}
+	return sessionSummary{
+		Device:      session.Device,
+		KeyPrefix:   prefix,
+		CreatedTime: session.CreatedTime,
+		ExpiryTime:  session.Deadline(),
+	}
+}
 
+// ownsCustomer reports whether the request carries a live session of the customer,
+// sending 401 when it does not.
+func (app *App) ownsCustomer(w http.ResponseWriter, r *http.Request, customerID int) bool {
+	sessionKey := app.sessionKey(r)
+	if sessionKey == "" {
+		app.sendResponse(w, http.StatusUnauthorized, "Session key required")
+		return false
+	}
+	owner, err := app.SessionManager.Authenticate(sessionKey, fingerprint(r))
+	if err != nil || owner.CustomerID != customerID {
+		app.sendResponse(w, http.StatusUnauthorized, "Invalid session key")
+		return false
+	}
+	return true
+}
+
+// 处理 POST /<customerid>/session/refresh，session key 的传递方式见 transport.go
+func (app *App) handleRefreshSession(w http.ResponseWriter, r *http.Request, customerID string) {
+	ID, err := strconv.Atoi(customerID)
+	if err != nil {
+		app.sendResponse(w, http.StatusBadRequest, "need input number")
+		return
+	}
+	sessionKey := app.sessionKey(r)
+	if sessionKey == "" {
+		app.sendResponse(w, http.StatusUnauthorized, "Session key required")
+		return
+	}
+	session, ok := app.SessionManager.Refresh(ID, sessionKey, fingerprint(r))
+	if !ok {
+		app.sendResponse(w, http.StatusUnauthorized, "Invalid session key")
+		return
+	}
+	app.setSessionCookie(w, session)
 	app.sendResponse(w, http.StatusOK, session.SessionKey)
 }
 
+// 处理 DELETE /<customerid>/session，需要该客户的 session key 或 X-Admin-Token
+func (app *App) handleRevokeSession(w http.ResponseWriter, r *http.Request, customerID string) {
+	ID, err := strconv.Atoi(customerID)
+	if err != nil {
+		app.sendResponse(w, http.StatusBadRequest, "need input number")
+		return
+	}
+	if !app.isAdmin(r) && !app.ownsCustomer(w, r, ID) {
+		return
+	}
+	if !app.SessionManager.Revoke(ID) {
+		app.sendResponse(w, http.StatusNotFound, "Session not found")
+		return
+	}
+	app.sendResponse(w, http.StatusNoContent, "")
+}
+
+// 处理 DELETE /session/<sessionkey>
+func (app *App) handleRevokeSessionKey(w http.ResponseWriter, r *http.Request, sessionKey string) {
+	if !app.SessionManager.RevokeKey(sessionKey) {
+		app.sendResponse(w, http.StatusNotFound, "Session not found")
+		return
+	}
+	app.sendResponse(w, http.StatusNoContent, "")
+}
+
+type sessionInfo struct {
+	*session.Session
+	TTLSeconds int64 `json:"ttl_seconds"`
+}
+
+// 处理 GET /session/<sessionkey>
+func (app *App) handleGetSessionInfo(w http.ResponseWriter, r *http.Request, sessionKey string) {
+	session, ok := app.SessionManager.Lookup(sessionKey, fingerprint(r))
+	if !ok {
+		app.sendResponse(w, http.StatusNotFound, "Session not found")
+		return
+	}
+	app.sendJSON(w, http.StatusOK, sessionInfo{
+		Session:    session,
+		TTLSeconds: int64(session.TTL() / time.Second),
+	})
+}
+
+// setSessionHeaders tells the client how long its session has left.
+func setSessionHeaders(w http.ResponseWriter, session *session.Session) {
+	w.Header().Set("X-Session-Expires", session.Deadline().UTC().Format(time.RFC3339))
+	w.Header().Set("X-Session-TTL", strconv.FormatInt(int64(session.TTL()/time.Second), 10))
+}
+
+// customerErrorStatus maps registry errors to responses: unknown customers are not
+// found, suspended ones forbidden and self-excluded ones unavailable for legal reasons.
+func customerErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, customer.ErrSuspended):
+		return http.StatusForbidden
+	case errors.Is(err, customer.ErrSelfExcluded):
+		return http.StatusUnavailableForLegalReasons
+	default:
+		return http.StatusNotFound
+	}
+}
+
+// fingerprint describes the client of r for session binding.
+func fingerprint(r *http.Request) session.Fingerprint {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	return session.Fingerprint{IP: ip, UserAgent: r.UserAgent()}
+}
+
+func sessionErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, session.ErrSessionExpired):
+		return "Session expired"
+	case errors.Is(err, session.ErrFingerprintMismatch):
+		return "Session not valid for this client"
+	default:
+		return "Invalid session key"
+	}
+}
+
 type PostStakeRequest struct {
 	Stake int `json:"stake"`
 }
 
-// 处理 POST /<betofferid>/stake?sessionkey=<sessionkey>
+// 处理 POST /<betofferid>/stake，session key 可以放在 header、cookie 或 ?session=
 func (app *App) handlePostStake(w http.ResponseWriter, r *http.Request, betOfferIDstring string) {
 	betOfferID, err := strconv.Atoi(betOfferIDstring)
 	if err != nil {
@@ -74,17 +445,19 @@ func (app *App) handlePostStake(w http.ResponseWriter, r *http.Request, betOffer
 		return
 	}
 
-	sessionKey := r.URL.Query().Get("session")
+	sessionKey := app.sessionKey(r)
 	if sessionKey == "" {
 		app.sendResponse(w, http.StatusUnauthorized, "Session key required")
 		return
 	}
 
-	customerID, ok := app.SessionManager.GetCustomerID(sessionKey)
-	if !ok {
-		app.sendResponse(w, http.StatusUnauthorized, "Invalid session key")
+	session, err := app.SessionManager.Authenticate(sessionKey, fingerprint(r))
+	if err != nil {
+		app.sendResponse(w, http.StatusUnauthorized, sessionErrorMessage(err))
 		return
 	}
+	customerID := session.CustomerID
+	setSessionHeaders(w, session)
 
 	// var stakeRequest PostStakeRequest
 	body, err := io.ReadAll(r.Body)
@@ -94,19 +467,60 @@ func (app *App) handlePostStake(w http.ResponseWriter, r *http.Request, betOffer
 	}
 
 	stakeStr := string(body)
-	stake, err := strconv.Atoi(stakeStr) // 将字符串转成 int
+	amount, err := strconv.Atoi(stakeStr) // 将字符串转成 int
 	if err != nil {
 		app.sendResponse(w, http.StatusBadRequest, "Invalid stake value")
 		return
 	}
 
 	log.Printf("handle post stake")
-	app.StakeMap.Insert(customerID, betOfferID, stake, maxHighStakes)
+	_, err = app.StakeMap.Place(betOfferID, stake.Stake{
+		CustomerID: customerID,
+		Amount:     amount,
+		SessionID:  session.KeyID(),
+	})
+	var limitErr *stake.LimitError
+	if errors.As(err, &limitErr) {
+		app.sendRejection(w, limitErr)
+		return
+	}
+	if err != nil {
+		app.sendResponse(w, offerErrorStatus(err), err.Error())
+		return
+	}
+
+	app.sendResponse(w, http.StatusNoContent, "")
+}
+
+// 处理 DELETE /<betofferid>/stake，撤回该 session 的客户在这个 bet offer 上的所有下注
+func (app *App) handleCancelStake(w http.ResponseWriter, r *http.Request, betOfferIDstring string) {
+	betOfferID, err := strconv.Atoi(betOfferIDstring)
+	if err != nil {
+		app.sendResponse(w, http.StatusBadRequest, "need input number")
+		return
+	}
+
+	sessionKey := app.sessionKey(r)
+	if sessionKey == "" {
+		app.sendResponse(w, http.StatusUnauthorized, "Session key required")
+		return
+	}
+	session, err := app.SessionManager.Authenticate(sessionKey, fingerprint(r))
+	if err != nil {
+		app.sendResponse(w, http.StatusUnauthorized, sessionErrorMessage(err))
+		return
+	}
+	setSessionHeaders(w, session)
 
+	if _, err := app.StakeMap.Cancel(betOfferID, session.CustomerID); err != nil {
+		app.sendResponse(w, offerErrorStatus(err), err.Error())
+		return
+	}
 	app.sendResponse(w, http.StatusNoContent, "")
 }
 
-// 处理 GET /<betofferid>/highstakes
+// 处理 GET /<betofferid>/highstakes?limit=N&timestamps=true，limit 超过排行榜深度时按深度返回，
+// timestamps 为 true 时每一项是 <customerid>=<stake>@<下注时间>
 func (app *App) handleGetHighStakes(w http.ResponseWriter, r *http.Request, betOfferID string) {
 	log.Printf(" start handle high stake")
 	ID, err := strconv.Atoi(betOfferID) // 将字符串转成 int
@@ -114,7 +528,33 @@ func (app *App) handleGetHighStakes(w http.ResponseWriter, r *http.Request, betO
 		app.sendResponse(w, http.StatusBadRequest, "Invalid input betOfferID")
 		return
 	}
-	topStakes, ok := app.StakeMap.GetTop(ID, 20)
+	limit := 0
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			app.sendResponse(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+	}
+	withTimes := false
+	if value := r.URL.Query().Get("timestamps"); value != "" {
+		withTimes, err = strconv.ParseBool(value)
+		if err != nil {
+			app.sendResponse(w, http.StatusBadRequest, "Invalid timestamps")
+			return
+		}
+	}
+	var topStakes []string
+	var ok bool
+	if withTimes {
+		var entries []stake.Entry
+		entries, ok = app.StakeMap.TopEntries(ID, limit)
+		for _, entry := range entries {
+			topStakes = append(topStakes, fmt.Sprintf("%d=%d@%s", entry.ID, entry.Value, entry.Placed.Format(time.RFC3339Nano)))
+		}
+	} else {
+		topStakes, ok = app.StakeMap.GetTop(ID, limit)
+	}
 	log.Printf(" handle highstake %d", len(topStakes))
 
 	if !ok {
@@ -126,6 +566,28 @@ func (app *App) handleGetHighStakes(w http.ResponseWriter, r *http.Request, betO
 	w.Write([]byte(strings.Join(topStakes, ",")))
 }
 
+// offerErrorStatus maps bet offer errors to response codes.
+func offerErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, stake.ErrUnknownOffer), errors.Is(err, stake.ErrNoStake):
+		return http.StatusNotFound
+	case errors.Is(err, stake.ErrOfferNotOpen), errors.Is(err, stake.ErrInvalidTransition), errors.Is(err, stake.ErrOfferExists):
+		return http.StatusConflict
+	}
+	return http.StatusBadRequest
+}
+
+func (app *App) sendJSON(w http.ResponseWriter, statusCode int, value interface{}) {
+	body, err := json.Marshal(value)
+	if err != nil {
+		app.sendResponse(w, http.StatusInternalServerError, "encode response failed")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	w.Write(body)
+}
+
 func (app *App) sendResponse(w http.ResponseWriter, statusCode int, message string) {
 	w.Header().Set("Content-Type", "text/plain") // 设置 Content-Type 为 text/plain
 	w.WriteHeader(statusCode)
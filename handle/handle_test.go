@@ -0,0 +1,193 @@
+package handle
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"httpProject/session"
+)
+
+const testAdminToken = "admin-secret"
+
+func newTestApp(t *testing.T, configure func(cfg *Config)) *App {
+	t.Helper()
+	cfg := DefaultConfig()
+	cfg.AdminToken = testAdminToken
+	if configure != nil {
+		configure(&cfg)
+	}
+	app, err := NewApp(cfg)
+	if err != nil {
+		t.Fatalf("NewApp: %v", err)
+	}
+	return app
+}
+
+// serve sends a request to app; headers are name, value pairs.
+func serve(app *App, method string, target string, body string, headers ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	for i := 0; i+1 < len(headers); i += 2 {
+		r.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, r)
+	return w
+}
+
+// issue gets a session key for the customer.
+func issue(t *testing.T, app *App, customerID string) string {
+	t.Helper()
+	w := serve(app, http.MethodGet, "/"+customerID+"/session", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /%s/session: %d %s", customerID, w.Code, w.Body)
+	}
+	return w.Body.String()
+}
+
+func bearer(key string) []string {
+	return []string{"Authorization", "Bearer " + key}
+}
+
+func TestRevokeSessionRequiresOwner(t *testing.T) {
+	app := newTestApp(t, nil)
+	key := issue(t, app, "1")
+	other := issue(t, app, "2")
+
+	if w := serve(app, http.MethodDelete, "/1/session", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected unauthenticated revoke to be rejected, got %d", w.Code)
+	}
+	if w := serve(app, http.MethodDelete, "/1/session", "", bearer(other)...); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected another customer's key to be rejected, got %d", w.Code)
+	}
+	if _, ok := app.SessionManager.Lookup(key, session.Fingerprint{}); !ok {
+		t.Fatalf("Expected session to survive rejected revokes")
+	}
+
+	if w := serve(app, http.MethodDelete, "/1/session", "", bearer(key)...); w.Code != http.StatusNoContent {
+		t.Errorf("Expected owner to revoke, got %d", w.Code)
+	}
+	if _, ok := app.SessionManager.Lookup(key, session.Fingerprint{}); ok {
+		t.Errorf("Expected session revoked")
+	}
+	if w := serve(app, http.MethodDelete, "/2/session", "", "X-Admin-Token", testAdminToken); w.Code != http.StatusNoContent {
+		t.Errorf("Expected admin to revoke, got %d", w.Code)
+	}
+}
+
+func TestListSessionsHidesKeys(t *testing.T) {
+	app := newTestApp(t, nil)
+	phone := serve(app, http.MethodGet, "/1/session?device=phone", "").Body.String()
+	desktop := serve(app, http.MethodGet, "/1/session?device=desktop", "").Body.String()
+
+	w := serve(app, http.MethodGet, "/1/sessions", "", bearer(phone)...)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected session list, got %d %s", w.Code, w.Body)
+	}
+	body := w.Body.String()
+	if strings.Contains(body, desktop) || strings.Contains(body, phone) {
+		t.Errorf("Expected session keys to be redacted, got %s", body)
+	}
+	if strings.Contains(body, "binding") {
+		t.Errorf("Expected no binding in the list, got %s", body)
+	}
+	if !strings.Contains(body, `"key_prefix":"`+desktop[:sessionKeyPrefixLength]+`"`) || !strings.Contains(body, `"device":"desktop"`) {
+		t.Errorf("Expected device and key prefix of every session, got %s", body)
+	}
+}
+
+func TestNewAppRejectsIntervals(t *testing.T) {
+	cases := map[string]func(cfg *Config){
+		"cleanup":  func(cfg *Config) { cfg.CleanupInterval = 0 },
+		"snapshot": func(cfg *Config) { cfg.SnapshotPath = "sessions.json"; cfg.SnapshotInterval = -time.Second },
+		"store":    func(cfg *Config) { cfg.StoreFile = "store.json"; cfg.SnapshotInterval = 0 },
+		"customer": func(cfg *Config) { cfg.CustomerFile = "customers.json"; cfg.CustomerReload = 0 },
+	}
+	for name, configure := range cases {
+		cfg := DefaultConfig()
+		configure(&cfg)
+		if _, err := NewApp(cfg); err == nil || !strings.Contains(err.Error(), "must be positive") {
+			t.Errorf("%s: expected interval error, got %v", name, err)
+		}
+	}
+}
+
+func TestSessionInfoChecksBinding(t *testing.T) {
+	app := newTestApp(t, func(cfg *Config) {
+		cfg.SessionBinding = session.BindingPolicy{Mode: session.BindingEnforce, BindUserAgent: true}
+	})
+	w := serve(app, http.MethodGet, "/1/session", "", "User-Agent", "phone")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /1/session: %d %s", w.Code, w.Body)
+	}
+	key := w.Body.String()
+
+	w = serve(app, http.MethodGet, "/session/"+key, "", "User-Agent", "phone")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected the bound client to see its session, got %d", w.Code)
+	}
+	if strings.Contains(w.Body.String(), "binding") || strings.Contains(w.Body.String(), "phone") {
+		t.Errorf("Expected the binding to stay private, got %s", w.Body)
+	}
+	if w := serve(app, http.MethodGet, "/session/"+key, "", "User-Agent", "laptop"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected another client to be refused, got %d", w.Code)
+	}
+}
+
+func TestStakesHideSessionKeys(t *testing.T) {
+	app := newTestApp(t, nil)
+	key := issue(t, app, "1")
+	if w := serve(app, http.MethodPost, "/7/stake", "100", bearer(key)...); w.Code != http.StatusNoContent {
+		t.Fatalf("POST /7/stake: %d %s", w.Code, w.Body)
+	}
+
+	if w := serve(app, http.MethodGet, "/admin/offers/7/stakes", ""); w.Code != http.StatusForbidden {
+		t.Errorf("Expected the stake history to need the admin token, got %d", w.Code)
+	}
+	w := serve(app, http.MethodGet, "/admin/offers/7/stakes", "", "X-Admin-Token", testAdminToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /admin/offers/7/stakes: %d %s", w.Code, w.Body)
+	}
+	if strings.Contains(w.Body.String(), key) {
+		t.Errorf("Expected stake history without session keys, got %s", w.Body)
+	}
+	if info, _ := app.SessionManager.Lookup(key, session.Fingerprint{}); !strings.Contains(w.Body.String(), info.KeyID()) {
+		t.Errorf("Expected stake history to identify the session, got %s", w.Body)
+	}
+}
+
+func TestSessionExpiryHonoursIdleTimeout(t *testing.T) {
+	policyFile := filepath.Join(t.TempDir(), "tiers.json")
+	os.WriteFile(policyFile, []byte(`{"default_tier": "short", "tiers": {"short": {"ttl": "1h", "idle_timeout": "1m"}}}`), 0o600)
+	app := newTestApp(t, func(cfg *Config) { cfg.PolicyFile = policyFile })
+
+	w := serve(app, http.MethodGet, "/1/session", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /1/session: %d %s", w.Code, w.Body)
+	}
+	key := w.Body.String()
+	// 空闲超时比 TTL 先到，返回给客户端的过期时间都要按空闲超时算
+	limit := time.Now().Add(time.Minute + time.Second)
+	if cookies := w.Result().Cookies(); len(cookies) != 1 || cookies[0].Expires.After(limit) {
+		t.Errorf("Expected the cookie to expire with the idle timeout, got %v", cookies)
+	}
+	w = serve(app, http.MethodPost, "/7/stake", "100", bearer(key)...)
+	expires, err := time.Parse(time.RFC3339, w.Header().Get("X-Session-Expires"))
+	if err != nil || expires.After(limit) {
+		t.Errorf("Expected X-Session-Expires within the idle timeout, got %q", w.Header().Get("X-Session-Expires"))
+	}
+
+	w = serve(app, http.MethodGet, "/1/sessions", "", bearer(key)...)
+	var sessions []sessionSummary
+	if err := json.Unmarshal(w.Body.Bytes(), &sessions); err != nil || len(sessions) != 1 {
+		t.Fatalf("GET /1/sessions: %d %s", w.Code, w.Body)
+	}
+	if sessions[0].ExpiryTime.After(limit) {
+		t.Errorf("Expected the listed expiry within the idle timeout, got %v", sessions[0].ExpiryTime)
+	}
+}
@@ -0,0 +1,65 @@
+package handle
+
+import (
+	"encoding/json"
+	"fmt"
+	"httpProject/stake"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Rejection is the response sent when a stake breaks a limit. Message may contain {limit}
+// and {amount}; an empty message sends the default error text.
+type Rejection struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+func DefaultRejections() map[stake.LimitReason]Rejection {
+	return map[stake.LimitReason]Rejection{
+		stake.LimitMinStake:      {Status: http.StatusUnprocessableEntity},
+		stake.LimitMaxStake:      {Status: http.StatusUnprocessableEntity},
+		stake.LimitOfferExposure: {Status: http.StatusForbidden},
+		stake.LimitDailyExposure: {Status: http.StatusForbidden},
+	}
+}
+
+// LoadRejections reads a JSON object of limit reason to Rejection; reasons left out keep the default.
+func LoadRejections(path string) (map[stake.LimitReason]Rejection, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var overrides map[stake.LimitReason]Rejection
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	rejections := DefaultRejections()
+	for reason, rejection := range overrides {
+		if _, ok := rejections[reason]; !ok {
+			return nil, fmt.Errorf("unknown stake limit %q in %s", reason, path)
+		}
+		if rejection.Status < 400 || rejection.Status > 599 {
+			return nil, fmt.Errorf("stake limit %q in %s: status %d is not an error status", reason, path, rejection.Status)
+		}
+		rejections[reason] = rejection
+	}
+	return rejections, nil
+}
+
+func (app *App) sendRejection(w http.ResponseWriter, err *stake.LimitError) {
+	rejection, ok := app.rejections[err.Reason]
+	if !ok {
+		rejection = DefaultRejections()[err.Reason]
+	}
+	message := err.Error()
+	if rejection.Message != "" {
+		message = strings.NewReplacer(
+			"{limit}", strconv.Itoa(err.Limit),
+			"{amount}", strconv.Itoa(err.Amount),
+		).Replace(rejection.Message)
+	}
+	app.sendResponse(w, rejection.Status, message)
+}
@@ -0,0 +1,65 @@
+package handle
+
+import (
+	"httpProject/stake"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeRejections(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "rejections.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadRejections(t *testing.T) {
+	rejections, err := LoadRejections(writeRejections(t, `{"max_stake": {"status": 400, "message": "at most {limit}"}}`))
+	if err != nil {
+		t.Fatalf("LoadRejections: %v", err)
+	}
+	if rejection := rejections[stake.LimitMaxStake]; rejection.Status != http.StatusBadRequest || rejection.Message != "at most {limit}" {
+		t.Errorf("Unexpected max_stake rejection %+v", rejection)
+	}
+	if rejection := rejections[stake.LimitDailyExposure]; rejection.Status != http.StatusForbidden {
+		t.Errorf("Expected reasons left out to keep the default, got %+v", rejection)
+	}
+
+	for name, content := range map[string]string{
+		"unknown reason": `{"max_bet": {"status": 400}}`,
+		"success status": `{"max_stake": {"status": 200}}`,
+		"missing status": `{"max_stake": {"message": "no"}}`,
+		"status too big": `{"max_stake": {"status": 600}}`,
+		"not json":       `max_stake=400`,
+	} {
+		if _, err := LoadRejections(writeRejections(t, content)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestSendRejection(t *testing.T) {
+	app := newTestApp(t, func(cfg *Config) {
+		cfg.RejectionFile = writeRejections(t, `{"offer_exposure": {"status": 409, "message": "{amount} is over your limit of {limit}, {amount}!"}}`)
+	})
+
+	w := httptest.NewRecorder()
+	app.sendRejection(w, &stake.LimitError{Reason: stake.LimitOfferExposure, Limit: 100, Amount: 30})
+	if w.Code != http.StatusConflict || strings.TrimSpace(w.Body.String()) != "30 is over your limit of 100, 30!" {
+		t.Errorf("Unexpected rejection %d %q", w.Code, w.Body)
+	}
+
+	// 没有配置 message 时使用默认的错误信息
+	w = httptest.NewRecorder()
+	limitErr := &stake.LimitError{Reason: stake.LimitMinStake, Limit: 5, Amount: 1}
+	app.sendRejection(w, limitErr)
+	if w.Code != http.StatusUnprocessableEntity || strings.TrimSpace(w.Body.String()) != limitErr.Error() {
+		t.Errorf("Unexpected default rejection %d %q", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,80 @@
+package handle
+
+import (
+	"fmt"
+	"httpProject/session"
+	"net/http"
+	"strings"
+)
+
+// 客户端传递 session key 的方式
+const (
+	TransportHeader = "header" // Authorization: Bearer <key>
+	TransportCookie = "cookie" // GET /<customerid>/session 设置的 HttpOnly cookie
+	TransportQuery  = "query"  // ?session=<key>
+)
+
+const sessionCookieName = "session"
+
+// ParseTransports reads a comma separated precedence list such as "header,cookie".
+func ParseTransports(value string) ([]string, error) {
+	var transports []string
+	for _, transport := range strings.Split(value, ",") {
+		transport = strings.TrimSpace(transport)
+		switch transport {
+		case TransportHeader, TransportCookie, TransportQuery:
+			transports = append(transports, transport)
+		case "":
+		default:
+			return nil, fmt.Errorf("unknown session transport %q", transport)
+		}
+	}
+	if len(transports) == 0 {
+		return nil, fmt.Errorf("at least one session transport is required")
+	}
+	return transports, nil
+}
+
+// sessionKey returns the first session key found in r, trying transports in the configured order.
+func (app *App) sessionKey(r *http.Request) string {
+	for _, transport := range app.transports {
+		switch transport {
+		case TransportHeader:
+			auth := r.Header.Get("Authorization")
+			if len(auth) > len("Bearer ") && strings.EqualFold(auth[:len("Bearer ")], "Bearer ") {
+				// 只有空白的 Bearer 当作没有，继续找下一种方式
+				if key := strings.TrimSpace(auth[len("Bearer "):]); key != "" {
+					return key
+				}
+			}
+		case TransportCookie:
+			if cookie, err := r.Cookie(sessionCookieName); err == nil && cookie.Value != "" {
+				return cookie.Value
+			}
+		case TransportQuery:
+			if key := r.URL.Query().Get("session"); key != "" {
+				return key
+			}
+		}
+	}
+	return ""
+}
+
+// setSessionCookie hands the session key to browsers when cookies are an accepted transport.
+func (app *App) setSessionCookie(w http.ResponseWriter, session *session.Session) {
+	for _, transport := range app.transports {
+		if transport != TransportCookie {
+			continue
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     sessionCookieName,
+			Value:    session.SessionKey,
+			Path:     "/",
+			Expires:  session.Deadline(),
+			HttpOnly: true,
+			Secure:   app.cookieSecure,
+			SameSite: http.SameSiteStrictMode,
+		})
+		return
+	}
+}
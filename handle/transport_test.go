@@ -0,0 +1,90 @@
+package handle
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseTransports(t *testing.T) {
+	transports, err := ParseTransports(" cookie, header ,")
+	if err != nil || !slices.Equal(transports, []string{TransportCookie, TransportHeader}) {
+		t.Errorf("Unexpected transports %v %v", transports, err)
+	}
+	for _, value := range []string{"", " , ", "header,body"} {
+		if _, err := ParseTransports(value); err == nil {
+			t.Errorf("Expected %q to be rejected", value)
+		}
+	}
+}
+
+func TestSessionKeyPrecedence(t *testing.T) {
+	request := func(auth string, cookie string, query string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/1/stake?session="+query, nil)
+		if auth != "" {
+			r.Header.Set("Authorization", auth)
+		}
+		if cookie != "" {
+			r.AddCookie(&http.Cookie{Name: sessionCookieName, Value: cookie})
+		}
+		return r
+	}
+	app := newTestApp(t, func(cfg *Config) {
+		cfg.SessionTransports = []string{TransportHeader, TransportCookie, TransportQuery}
+	})
+	cases := []struct {
+		name     string
+		r        *http.Request
+		expected string
+	}{
+		{"header first", request("Bearer h", "c", "q"), "h"},
+		{"case insensitive scheme", request("bearer h", "", ""), "h"},
+		{"cookie before query", request("", "c", "q"), "c"},
+		{"query last", request("", "", "q"), "q"},
+		{"blank bearer falls through", request("Bearer   ", "c", "q"), "c"},
+		{"other scheme ignored", request("Basic h", "", "q"), "q"},
+		{"nothing", request("", "", ""), ""},
+	}
+	for _, c := range cases {
+		if key := app.sessionKey(c.r); key != c.expected {
+			t.Errorf("%s: expected %q, got %q", c.name, c.expected, key)
+		}
+	}
+
+	// 配置里去掉 query 之后不再接受 ?session=
+	noQuery := newTestApp(t, func(cfg *Config) {
+		cfg.SessionTransports = []string{TransportCookie, TransportHeader}
+	})
+	if key := noQuery.sessionKey(request("", "", "q")); key != "" {
+		t.Errorf("Expected the query transport to be disabled, got %q", key)
+	}
+	if key := noQuery.sessionKey(request("Bearer h", "c", "")); key != "c" {
+		t.Errorf("Expected cookie to take precedence, got %q", key)
+	}
+}
+
+func TestSessionCookie(t *testing.T) {
+	app := newTestApp(t, func(cfg *Config) { cfg.CookieSecure = true })
+	w := serve(app, http.MethodGet, "/1/session", "")
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("Expected one session cookie, got %v", cookies)
+	}
+	cookie := cookies[0]
+	if cookie.Name != sessionCookieName || cookie.Value != w.Body.String() || cookie.Path != "/" {
+		t.Errorf("Unexpected session cookie %+v", cookie)
+	}
+	if !cookie.HttpOnly || !cookie.Secure || cookie.SameSite != http.SameSiteStrictMode {
+		t.Errorf("Expected an HttpOnly, Secure, SameSite=Strict cookie, got %+v", cookie)
+	}
+	if time.Until(cookie.Expires) <= 0 {
+		t.Errorf("Expected the cookie to expire with the session, got %v", cookie.Expires)
+	}
+
+	headerOnly := newTestApp(t, func(cfg *Config) { cfg.SessionTransports = []string{TransportHeader} })
+	if cookies := serve(headerOnly, http.MethodGet, "/1/session", "").Result().Cookies(); len(cookies) != 0 {
+		t.Errorf("Expected no cookie when cookies are not a transport, got %v", cookies)
+	}
+}
@@ -1,25 +1,136 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"httpProject/handle"
+	"httpProject/session"
+	"httpProject/stake"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 )
 
-const port = 9000
+const (
+	port            = 9000
+	shutdownTimeout = 10 * time.Second
+	eventBuffer     = 1024
+)
 
 func main() {
-	app := handle.NewApp()
-	go app.SessionManager.SessionCleanup()
+	cfg := handle.DefaultConfig()
+	flag.StringVar(&cfg.SnapshotPath, "session-snapshot", "sessions.json", "file used to keep sessions across restarts, empty to disable")
+	flag.DurationVar(&cfg.SnapshotInterval, "session-snapshot-interval", cfg.SnapshotInterval, "how often sessions are written to the snapshot file and the store file")
+	flag.StringVar(&cfg.StoreFile, "session-store-file", "", "keep sessions in this file instead of only in memory; changes are written every snapshot interval")
+	flag.DurationVar(&cfg.CleanupInterval, "session-cleanup-interval", cfg.CleanupInterval, "how often expired sessions are removed")
+	flag.DurationVar(&cfg.SessionTTL, "session-ttl", cfg.SessionTTL, "lifetime of a new session unless its customer tier says otherwise")
+	flag.StringVar(&cfg.PolicyFile, "session-policy-file", "", "JSON file with per-tier session TTL, idle timeout and session limits")
+	flag.StringVar(&cfg.TokenKeyFile, "session-token-keys", "", "JSON file of token signing keys; when set, sessions are stateless signed tokens. Revocations stay in this process's memory and are not seen by other instances")
+	flag.BoolVar(&cfg.SlidingExpiry, "session-sliding", false, "extend a session every time it is used to place a stake")
+	flag.DurationVar(&cfg.MaxSessionLifetime, "session-max-lifetime", cfg.MaxSessionLifetime, "longest a session can be extended past its creation, 0 for no limit")
+	flag.IntVar(&cfg.MaxSessions, "session-max-per-customer", cfg.MaxSessions, "sessions a customer can hold across devices before the oldest is evicted, 0 for no limit")
+	flag.StringVar(&cfg.CustomerFile, "customers", "", "JSON or CSV file of customers allowed to get a session, empty to allow everyone")
+	flag.DurationVar(&cfg.CustomerReload, "customers-reload-interval", cfg.CustomerReload, "how often the customer file is checked for changes")
+	flag.StringVar(&cfg.PartnerFile, "partners", "", "JSON file of partner IDs and shared secrets; when set, session requests must be signed")
+	flag.DurationVar(&cfg.SignatureMaxSkew, "signature-max-skew", cfg.SignatureMaxSkew, "how far a signed request timestamp may be from the server clock")
+	transports := flag.String("session-transports", "header,cookie,query", "where stake requests may carry the session key, in order of precedence; leave out query to disable ?session=")
+	flag.BoolVar(&cfg.CookieSecure, "session-cookie-secure", false, "mark the session cookie Secure so it is only sent over HTTPS")
+	flag.StringVar(&cfg.AdminToken, "admin-token", "", "token expected in X-Admin-Token for /admin endpoints, empty to disable them")
+	flag.IntVar(&cfg.LeaderboardDepth, "leaderboard-depth", cfg.LeaderboardDepth, "default number of top stakes kept per bet offer")
+	stakeMerge := flag.String("stake-merge", "max", "how repeated stakes of a customer combine on the leaderboard: max, latest, sum or count")
+	flag.BoolVar(&cfg.AutoCreateOffers, "auto-create-offers", cfg.AutoCreateOffers, "create a bet offer on its first stake; when false offers must be created through the admin API")
+	flag.IntVar(&cfg.MinStake, "stake-min", cfg.MinStake, "smallest stake accepted on a bet offer, stakes below 1 are always rejected")
+	flag.IntVar(&cfg.MaxStake, "stake-max", cfg.MaxStake, "largest stake accepted on a bet offer, 0 for no limit")
+	flag.IntVar(&cfg.MaxExposure, "stake-max-exposure", cfg.MaxExposure, "most a customer can stake in total on one bet offer, 0 for no limit")
+	flag.IntVar(&cfg.DailyExposure, "stake-daily-exposure", cfg.DailyExposure, "most a customer can stake in total per UTC day, 0 for no limit")
+	flag.StringVar(&cfg.RejectionFile, "stake-rejections", "", "JSON file of status and message per stake limit, e.g. {\"max_stake\": {\"status\": 422, \"message\": \"at most {limit}\"}}")
+	stakeTies := flag.String("stake-ties", "first", "who ranks higher among equal stakes: first or last to reach the amount")
+	bindingMode := flag.String("session-binding", "off", "session binding to the client: off, log or enforce")
+	flag.BoolVar(&cfg.SessionBinding.BindIP, "session-bind-ip", false, "bind sessions to the client IP prefix")
+	flag.BoolVar(&cfg.SessionBinding.BindUserAgent, "session-bind-user-agent", false, "bind sessions to the client User-Agent")
+	flag.Parse()
+
+	mode, err := session.ParseBindingMode(*bindingMode)
+	if err != nil {
+		log.Fatalf("Invalid flags: %v\n", err)
+	}
+	cfg.SessionBinding.Mode = mode
+	if cfg.SessionTransports, err = handle.ParseTransports(*transports); err != nil {
+		log.Fatalf("Invalid flags: %v\n", err)
+	}
+	if cfg.StakeMerge, err = stake.ParseMergePolicy(*stakeMerge); err != nil {
+		log.Fatalf("Invalid flags: %v\n", err)
+	}
+	if cfg.StakeTies, err = stake.ParseTieBreak(*stakeTies); err != nil {
+		log.Fatalf("Invalid flags: %v\n", err)
+	}
+
+	app, err := handle.NewApp(cfg)
+	if err != nil {
+		log.Fatalf("Could not start app: %v\n", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	// 后台任务在 server 停止之后再结束，保证最后一次 snapshot 包含所有请求
+	background, stopBackground := context.WithCancel(context.Background())
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		app.SessionManager.SessionCleanup(background, cfg.CleanupInterval)
+	}()
+	if app.Customers != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			app.Customers.Watch(background, cfg.CustomerReload)
+		}()
+	}
+	// session 事件写入审计日志
+	events := app.SessionManager.Subscribe(eventBuffer)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for event := range events.C {
+			log.Printf("audit: session %s for customer %d device %q", event.Type, event.CustomerID, event.Device)
+		}
+	}()
+	if cfg.SnapshotPath != "" || cfg.StoreFile != "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			app.SessionManager.SnapshotLoop(background, cfg.SnapshotPath, cfg.SnapshotInterval)
+		}()
+	}
 	log.Printf("Server starting on port: %d\n", port)
 
 	server := &http.Server{
 		Addr:    fmt.Sprintf(":%d", port),
 		Handler: app,
 	}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Could not start server: %v\n", err)
+		}
+	}()
 
-	if err := server.ListenAndServe(); err != nil {
-		log.Fatalf("Could not start server: %v\n", err)
+	<-ctx.Done()
+	log.Printf("Server shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Server shutdown failed: %v\n", err)
 	}
+	stopBackground()
+	events.Close()
+	wg.Wait()
+	log.Printf("Server stopped")
 }
@@ -0,0 +1,77 @@
+package session
+
+import (
+	"sync"
+	"time"
+)
+
+// Denylist holds signed tokens revoked before they expire. Every process validating
+// the same tokens has to see the same Denylist for a revoke to take effect everywhere.
+type Denylist interface {
+	// RevokeToken rejects one token until its expiry.
+	RevokeToken(tokenID string, expiry time.Time)
+	// RevokeCustomer rejects every token the customer was issued up to at.
+	RevokeCustomer(customerID int, at time.Time)
+	Revoked(tokenID string, customerID int, issuedAt time.Time) bool
+	// Prune drops entries that can no longer match a live token and returns how many.
+	Prune(now time.Time, maxLifetime time.Duration) int
+}
+
+// MemoryDenylist is a Denylist local to the process, the default in token mode.
+type MemoryDenylist struct {
+	mu        sync.Mutex
+	tokens    map[string]time.Time // tokenId -> token 过期时间
+	customers map[int]time.Time    // customerId -> 在这之前签发的 token 都无效
+}
+
+func NewMemoryDenylist() *MemoryDenylist {
+	return &MemoryDenylist{
+		tokens:    make(map[string]time.Time),
+		customers: make(map[int]time.Time),
+	}
+}
+
+func (d *MemoryDenylist) RevokeToken(tokenID string, expiry time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.tokens[tokenID] = expiry
+}
+
+func (d *MemoryDenylist) RevokeCustomer(customerID int, at time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.customers[customerID] = at
+}
+
+func (d *MemoryDenylist) Revoked(tokenID string, customerID int, issuedAt time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.tokens[tokenID]; ok {
+		return true
+	}
+	revokedAt, ok := d.customers[customerID]
+	return ok && !issuedAt.After(revokedAt)
+}
+
+// Prune drops customer revocations once maxLifetime has passed, since every token
+// issued before them has expired by then. Without a maxLifetime they are kept.
+func (d *MemoryDenylist) Prune(now time.Time, maxLifetime time.Duration) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	pruned := 0
+	for tokenID, expiry := range d.tokens {
+		if now.After(expiry) {
+			delete(d.tokens, tokenID)
+			pruned++
+		}
+	}
+	if maxLifetime > 0 {
+		for customerID, revokedAt := range d.customers {
+			if now.After(revokedAt.Add(maxLifetime)) {
+				delete(d.customers, customerID)
+				pruned++
+			}
+		}
+	}
+	return pruned
+}
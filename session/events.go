@@ -0,0 +1,110 @@
+package session
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type EventType int
+
+const (
+	EventCreated EventType = iota
+	EventRefreshed
+	EventExpired
+	EventRevoked
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventCreated:
+		return "created"
+	case EventRefreshed:
+		return "refreshed"
+	case EventExpired:
+		return "expired"
+	case EventRevoked:
+		return "revoked"
+	}
+	return "unknown"
+}
+
+type Event struct {
+	Type       EventType
+	CustomerID int
+	SessionKey string
+	Device     string
+	Time       time.Time
+}
+
+// Subscription receives session events on C. When a subscriber falls behind and
+// its buffer is full, new events are dropped instead of blocking the manager.
+type Subscription struct {
+	C       <-chan Event
+	ch      chan Event
+	dropped atomic.Uint64
+	events  *eventHub
+}
+
+// Dropped returns how many events were lost because the buffer was full.
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Close stops delivery and closes C.
+func (s *Subscription) Close() {
+	s.events.unsubscribe(s)
+}
+
+type eventHub struct {
+	mu          sync.RWMutex
+	subscribers map[*Subscription]struct{}
+}
+
+func (h *eventHub) subscribe(buffer int) *Subscription {
+	ch := make(chan Event, buffer)
+	sub := &Subscription{C: ch, ch: ch, events: h}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subscribers == nil {
+		h.subscribers = make(map[*Subscription]struct{})
+	}
+	h.subscribers[sub] = struct{}{}
+	return sub
+}
+
+func (h *eventHub) unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subscribers[sub]; ok {
+		delete(h.subscribers, sub)
+		close(sub.ch)
+	}
+}
+
+func (h *eventHub) publish(eventType EventType, session *Session) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if len(h.subscribers) == 0 {
+		return
+	}
+	event := Event{
+		Type:       eventType,
+		CustomerID: session.CustomerID,
+		SessionKey: session.SessionKey,
+		Device:     session.Device,
+		Time:       time.Now(),
+	}
+	for sub := range h.subscribers {
+		select {
+		case sub.ch <- event:
+		default:
+			sub.dropped.Add(1)
+		}
+	}
+}
+
+// Subscribe returns a subscription buffering up to buffer events.
+func (m *SessionManager) Subscribe(buffer int) *Subscription {
+	return m.events.subscribe(buffer)
+}
@@ -0,0 +1,52 @@
+package session
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessionEvents(t *testing.T) {
+	sessionManager := NewSessionManager()
+	sub := sessionManager.Subscribe(10)
+	defer sub.Close()
+
+	session := sessionManager.GetSession(1)
+	sessionManager.Refresh(1, session.SessionKey, Fingerprint{})
+	sessionManager.RevokeKey(session.SessionKey)
+	expired := sessionManager.GetSession(2)
+	expired.ExpiryTime = time.Now().Add(-time.Minute)
+	sessionManager.store.Put(expired)
+	sessionManager.Sweep(time.Now())
+
+	expected := []EventType{EventCreated, EventRefreshed, EventRevoked, EventCreated, EventExpired}
+	for _, eventType := range expected {
+		select {
+		case event := <-sub.C:
+			if event.Type != eventType {
+				t.Errorf("Expected %s event, got %s", eventType, event.Type)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Expected %s event, got nothing", eventType)
+		}
+	}
+}
+
+func TestSessionEventsBounded(t *testing.T) {
+	sessionManager := NewSessionManager()
+	sub := sessionManager.Subscribe(1)
+
+	// 订阅者不读取时不会阻塞
+	sessionManager.GetSession(1)
+	sessionManager.GetSession(2)
+	sessionManager.GetSession(3)
+	if dropped := sub.Dropped(); dropped != 2 {
+		t.Errorf("Expected 2 dropped events, got %d", dropped)
+	}
+
+	sub.Close()
+	<-sub.C
+	if _, ok := <-sub.C; ok {
+		t.Errorf("Expected channel to be closed")
+	}
+	sessionManager.GetSession(4)
+}
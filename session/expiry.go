@@ -0,0 +1,70 @@
+package session
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+type expiryEntry struct {
+	expiry time.Time
+	key    string
+}
+
+type expiryHeap []expiryEntry
+
+func (h expiryHeap) Len() int            { return len(h) }
+func (h expiryHeap) Less(i, j int) bool  { return h[i].expiry.Before(h[j].expiry) }
+func (h expiryHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *expiryHeap) Push(x interface{}) { *h = append(*h, x.(expiryEntry)) }
+func (h *expiryHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	entry := old[n-1]
+	*h = old[:n-1]
+	return entry
+}
+
+// expiryIndex is a min-heap of session expiry times, so a sweep only looks at
+// sessions that are due instead of every stored session. Entries are removed
+// lazily: a deleted session or one Put with an earlier expiry leaves a stale entry
+// behind that is dropped when it reaches the top. A later expiry is not indexed
+// at all, the sweep indexes the session again when its old entry comes due.
+type expiryIndex struct {
+	mu      sync.Mutex
+	heap    expiryHeap
+	current map[string]time.Time // sessionKey -> expiry of its newest entry
+}
+
+func (x *expiryIndex) push(session *Session) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.pushLocked(session.SessionKey, session.Deadline())
+}
+
+func (x *expiryIndex) pushLocked(key string, expiry time.Time) {
+	if x.current == nil {
+		x.current = make(map[string]time.Time)
+	}
+	if indexed, ok := x.current[key]; ok && !expiry.Before(indexed) {
+		return
+	}
+	x.current[key] = expiry
+	heap.Push(&x.heap, expiryEntry{expiry: expiry, key: key})
+}
+
+// due pops the newest entry of every key whose recorded expiry is before now.
+func (x *expiryIndex) due(now time.Time) []string {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	var keys []string
+	for x.heap.Len() > 0 && x.heap[0].expiry.Before(now) {
+		entry := heap.Pop(&x.heap).(expiryEntry)
+		if indexed, ok := x.current[entry.key]; !ok || !indexed.Equal(entry.expiry) {
+			continue // 过时的记录
+		}
+		delete(x.current, entry.key)
+		keys = append(keys, entry.key)
+	}
+	return keys
+}
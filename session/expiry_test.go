@@ -0,0 +1,129 @@
+package session
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRangeExpiredIndex(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		store.Put(&Session{CustomerID: i, SessionKey: fmt.Sprint(i), CreatedTime: now, ExpiryTime: now.Add(time.Duration(i-5) * time.Minute)})
+	}
+
+	// 延长一个已到期的 session，它不应该被清理
+	stored, _ := store.GetBySessionKey("0")
+	extended := *stored
+	extended.ExpiryTime = now.Add(time.Hour)
+	store.Put(&extended)
+
+	var expired []*Session
+	store.RangeExpired(now, func(session *Session) bool {
+		expired = append(expired, session)
+		return true
+	})
+	if len(expired) != 4 {
+		t.Fatalf("Expected 4 expired sessions, got %d", len(expired))
+	}
+	for _, session := range expired {
+		store.Delete(session)
+	}
+
+	count := 0
+	store.RangeExpired(now, func(session *Session) bool {
+		count++
+		return true
+	})
+	if count != 0 {
+		t.Errorf("Expected no expired sessions after delete, got %d", count)
+	}
+
+	// 没有删除的过期 session 下次还能找到
+	store.RangeExpired(now.Add(2*time.Minute), func(session *Session) bool { return false })
+	count = 0
+	store.RangeExpired(now.Add(2*time.Minute), func(session *Session) bool {
+		count++
+		return true
+	})
+	if count != 2 {
+		t.Errorf("Expected 2 expired sessions to still be indexed, got %d", count)
+	}
+}
+
+func newBenchmarkStore(total, expired int) *MemoryStore {
+	store := NewMemoryStore()
+	now := time.Now()
+	for i := 0; i < total; i++ {
+		expiry := now.Add(time.Hour)
+		if i < expired {
+			expiry = now.Add(-time.Minute)
+		}
+		store.Put(&Session{CustomerID: i, SessionKey: fmt.Sprint(i), CreatedTime: now, ExpiryTime: expiry})
+	}
+	return store
+}
+
+// scanExpired is the full Range sweep SessionCleanup used before the expiry index.
+func scanExpired(store *MemoryStore, now time.Time, f func(session *Session) bool) {
+	store.Range(func(session *Session) bool {
+		if session.expiredAt(now) {
+			return f(session)
+		}
+		return true
+	})
+}
+
+func BenchmarkCleanupHeap(b *testing.B) {
+	for _, total := range []int{10000, 100000} {
+		b.Run(fmt.Sprint(total), func(b *testing.B) {
+			store := newBenchmarkStore(total, total/100)
+			now := time.Now()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				store.RangeExpired(now, func(session *Session) bool { return true })
+			}
+		})
+	}
+}
+
+func BenchmarkCleanupScan(b *testing.B) {
+	for _, total := range []int{10000, 100000} {
+		b.Run(fmt.Sprint(total), func(b *testing.B) {
+			store := newBenchmarkStore(total, total/100)
+			now := time.Now()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				scanExpired(store, now, func(session *Session) bool { return true })
+			}
+		})
+	}
+}
+
+func TestExpiryIndexBounded(t *testing.T) {
+	sessionManager := NewSessionManager(WithSlidingExpiry())
+	session := sessionManager.GetSession(1)
+	early := *session
+	early.ExpiryTime = time.Now().Add(time.Minute)
+	sessionManager.store.Put(&early)
+	for i := 0; i < 1000; i++ {
+		if _, err := sessionManager.Authenticate(session.SessionKey, Fingerprint{}); err != nil {
+			t.Fatalf("Authenticate: %v", err)
+		}
+	}
+	store := sessionManager.store.(*MemoryStore)
+	// 创建时和提前过期时各一条，之后的使用不再增加
+	if size := store.shard(1).expiry.heap.Len(); size != 2 {
+		t.Errorf("Expected 2 indexed entries after repeated use, got %d", size)
+	}
+
+	// 延长过的 session 到了原来的过期时间不会被清理，之后按新的过期时间清理
+	extended, _ := sessionManager.Lookup(session.SessionKey, Fingerprint{})
+	if evicted := sessionManager.Sweep(early.ExpiryTime.Add(time.Second)); evicted != 0 {
+		t.Errorf("Expected extended session to survive its old expiry, got %d evicted", evicted)
+	}
+	if evicted := sessionManager.Sweep(extended.ExpiryTime.Add(time.Millisecond)); evicted != 1 {
+		t.Errorf("Expected session evicted at its new expiry, got %d", evicted)
+	}
+}
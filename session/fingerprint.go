@@ -0,0 +1,101 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+)
+
+var (
+	ErrSessionNotFound     = errors.New("session not found")
+	ErrSessionExpired      = errors.New("session expired")
+	ErrFingerprintMismatch = errors.New("session used from a different client")
+)
+
+// Fingerprint identifies the client a request came from.
+type Fingerprint struct {
+	IP        string `json:"ip,omitempty"` // 绑定后保存的是 IP 前缀
+	UserAgent string `json:"user_agent,omitempty"`
+}
+
+type BindingMode int
+
+const (
+	BindingOff     BindingMode = iota
+	BindingLog                 // 只记录不一致的请求
+	BindingEnforce             // 拒绝不一致的请求
+)
+
+func ParseBindingMode(mode string) (BindingMode, error) {
+	switch mode {
+	case "", "off":
+		return BindingOff, nil
+	case "log":
+		return BindingLog, nil
+	case "enforce":
+		return BindingEnforce, nil
+	}
+	return BindingOff, fmt.Errorf("unknown session binding mode %q", mode)
+}
+
+// BindingPolicy decides which parts of the client fingerprint a session is bound to.
+type BindingPolicy struct {
+	Mode          BindingMode
+	BindIP        bool
+	BindUserAgent bool
+	IPv4Prefix    int // 比较前多少位，0 表示整个地址
+	IPv6Prefix    int
+}
+
+func DefaultBindingPolicy() BindingPolicy {
+	return BindingPolicy{
+		IPv4Prefix: 24,
+		IPv6Prefix: 64,
+	}
+}
+
+// bind returns the parts of fp a new session is bound to, nil when nothing is bound.
+func (p BindingPolicy) bind(fp Fingerprint) *Fingerprint {
+	if p.Mode == BindingOff || (!p.BindIP && !p.BindUserAgent) {
+		return nil
+	}
+	bound := &Fingerprint{}
+	if p.BindIP {
+		bound.IP = p.ipPrefix(fp.IP)
+	}
+	if p.BindUserAgent {
+		bound.UserAgent = fp.UserAgent
+	}
+	return bound
+}
+
+func (p BindingPolicy) matches(bound *Fingerprint, fp Fingerprint) bool {
+	if bound == nil {
+		return true
+	}
+	current := p.bind(fp)
+	if current == nil {
+		return true
+	}
+	return *current == *bound
+}
+
+func (p BindingPolicy) ipPrefix(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ip
+	}
+	addr = addr.Unmap()
+	bits := p.IPv6Prefix
+	if addr.Is4() {
+		bits = p.IPv4Prefix
+	}
+	if bits <= 0 || bits >= addr.BitLen() {
+		return addr.String()
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return addr.String()
+	}
+	return prefix.String()
+}
@@ -0,0 +1,60 @@
+package session
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBindingPolicyIPPrefix(t *testing.T) {
+	policy := DefaultBindingPolicy()
+	cases := map[string]string{
+		"10.1.2.3":          "10.1.2.0/24",
+		"::ffff:10.1.2.3":   "10.1.2.0/24",
+		"2001:db8:1:2:3::4": "2001:db8:1:2::/64",
+		"not-an-ip":         "not-an-ip",
+	}
+	for ip, expected := range cases {
+		if got := policy.ipPrefix(ip); got != expected {
+			t.Errorf("ipPrefix(%q) = %q, expected %q", ip, got, expected)
+		}
+	}
+}
+
+func TestSessionBinding(t *testing.T) {
+	policy := DefaultBindingPolicy()
+	policy.Mode = BindingEnforce
+	policy.BindIP = true
+	policy.BindUserAgent = true
+	sessionManager := NewSessionManager(WithBindingPolicy(policy))
+
+	home := Fingerprint{IP: "10.1.2.3", UserAgent: "app/1.0"}
+	session := sessionManager.Issue(1, IssueOptions{Fingerprint: home})
+
+	// 同一个网段的请求可以使用
+	if _, err := sessionManager.Authenticate(session.SessionKey, Fingerprint{IP: "10.1.2.200", UserAgent: "app/1.0"}); err != nil {
+		t.Errorf("Expected same prefix to be accepted, got %v", err)
+	}
+	if _, err := sessionManager.Authenticate(session.SessionKey, Fingerprint{IP: "10.9.9.9", UserAgent: "app/1.0"}); !errors.Is(err, ErrFingerprintMismatch) {
+		t.Errorf("Expected different network to be rejected, got %v", err)
+	}
+	if _, err := sessionManager.Authenticate(session.SessionKey, Fingerprint{IP: "10.1.2.3", UserAgent: "curl"}); !errors.Is(err, ErrFingerprintMismatch) {
+		t.Errorf("Expected different user agent to be rejected, got %v", err)
+	}
+	if _, ok := sessionManager.GetCustomerID(session.SessionKey); ok {
+		t.Errorf("Expected lookup without fingerprint to be rejected")
+	}
+
+	// 其他客户端请求 session 时不会拿到已绑定的 key
+	other := sessionManager.Issue(1, IssueOptions{Fingerprint: Fingerprint{IP: "10.9.9.9", UserAgent: "app/1.0"}})
+	if other.SessionKey == session.SessionKey {
+		t.Errorf("Expected a new session for a different client")
+	}
+
+	// 只记录模式下不拒绝
+	policy.Mode = BindingLog
+	logOnly := NewSessionManager(WithBindingPolicy(policy))
+	session = logOnly.Issue(1, IssueOptions{Fingerprint: home})
+	if _, err := logOnly.Authenticate(session.SessionKey, Fingerprint{IP: "10.9.9.9"}); err != nil {
+		t.Errorf("Expected log mode to accept mismatches, got %v", err)
+	}
+}
@@ -0,0 +1,62 @@
+package session
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+const (
+	DefaultKeyLength   = 20
+	DefaultKeyAlphabet = "abcdefghijklmnopqrstuvwxyz0123456789"
+)
+
+// KeyGenerator produces new session keys.
+type KeyGenerator interface {
+	GenerateKey() (string, error)
+}
+
+// RandomKeyGenerator draws keys uniformly from Alphabet using crypto/rand.
+type RandomKeyGenerator struct {
+	length   int
+	alphabet string
+}
+
+func NewRandomKeyGenerator(length int, alphabet string) (*RandomKeyGenerator, error) {
+	if length <= 0 {
+		return nil, errors.New("session key length must be positive")
+	}
+	if len(alphabet) < 2 || len(alphabet) > 256 {
+		return nil, errors.New("session key alphabet must have between 2 and 256 characters")
+	}
+	seen := make(map[byte]bool, len(alphabet))
+	for i := 0; i < len(alphabet); i++ {
+		if seen[alphabet[i]] {
+			return nil, fmt.Errorf("session key alphabet has duplicate character %q", alphabet[i])
+		}
+		seen[alphabet[i]] = true
+	}
+	return &RandomKeyGenerator{length: length, alphabet: alphabet}, nil
+}
+
+func (g *RandomKeyGenerator) GenerateKey() (string, error) {
+	// 丢弃超过 limit 的字节，避免取模带来的偏差
+	limit := 256 - 256%len(g.alphabet)
+	key := make([]byte, 0, g.length)
+	buf := make([]byte, g.length)
+	for len(key) < g.length {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		for _, b := range buf {
+			if int(b) >= limit {
+				continue
+			}
+			key = append(key, g.alphabet[int(b)%len(g.alphabet)])
+			if len(key) == g.length {
+				break
+			}
+		}
+	}
+	return string(key), nil
+}
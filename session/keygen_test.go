@@ -0,0 +1,48 @@
+package session
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRandomKeyGenerator(t *testing.T) {
+	generator, err := NewRandomKeyGenerator(32, "ab")
+	if err != nil {
+		t.Fatalf("NewRandomKeyGenerator: %v", err)
+	}
+	key, err := generator.GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	if len(key) != 32 || strings.Trim(key, "ab") != "" {
+		t.Errorf("Expected 32 characters from alphabet, got %q", key)
+	}
+
+	if _, err := NewRandomKeyGenerator(0, DefaultKeyAlphabet); err == nil {
+		t.Errorf("Expected error for zero length")
+	}
+	if _, err := NewRandomKeyGenerator(10, "aa"); err == nil {
+		t.Errorf("Expected error for duplicate alphabet characters")
+	}
+}
+
+type sequenceKeyGenerator struct {
+	keys []string
+}
+
+func (g *sequenceKeyGenerator) GenerateKey() (string, error) {
+	key := g.keys[0]
+	g.keys = g.keys[1:]
+	return key, nil
+}
+
+func TestGenerateSessionKeyCollision(t *testing.T) {
+	generator := &sequenceKeyGenerator{keys: []string{"same", "same", "other"}}
+	sessionManager := NewSessionManager(WithKeyGenerator(generator))
+
+	first := sessionManager.GetSession(1)
+	second := sessionManager.GetSession(2)
+	if first.SessionKey != "same" || second.SessionKey != "other" {
+		t.Errorf("Expected colliding key to be regenerated, got %q and %q", first.SessionKey, second.SessionKey)
+	}
+}
@@ -0,0 +1,105 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Policy is how sessions of one customer are issued. Once resolved, a zero IdleTimeout
+// or MaxSessions means no limit; see PolicyProvider for how a tier asks for that.
+type Policy struct {
+	TTL         time.Duration // 新 session 的有效期，也是每次延长的长度
+	IdleTimeout time.Duration // 超过这么久没有使用就过期，0 表示不限制
+	MaxSessions int           // 同时存在的 session 数量，0 表示不限制
+}
+
+// PolicyProvider resolves the session policy of a customer. Zero fields in the
+// returned policy fall back to the SessionManager defaults; a negative IdleTimeout
+// or MaxSessions means no limit for that customer.
+type PolicyProvider interface {
+	PolicyFor(customerID int) Policy
+}
+
+// TierPolicies assigns customers to named tiers, each with its own policy.
+type TierPolicies struct {
+	DefaultTier string
+	Tiers       map[string]Policy
+	Customers   map[int]string // customerId -> tier
+}
+
+func (p *TierPolicies) PolicyFor(customerID int) Policy {
+	tier, ok := p.Customers[customerID]
+	if !ok {
+		tier = p.DefaultTier
+	}
+	return p.Tiers[tier]
+}
+
+type tierPolicyFile struct {
+	DefaultTier string `json:"default_tier"`
+	Tiers       map[string]struct {
+		TTL         string `json:"ttl"`
+		IdleTimeout string `json:"idle_timeout"`
+		MaxSessions int    `json:"max_sessions"`
+	} `json:"tiers"`
+	Customers map[string]string `json:"customers"` // customerId -> tier
+}
+
+// LoadTierPolicies reads tier policies from a JSON file such as
+//
+//	{"default_tier": "standard",
+//	 "tiers": {"standard": {"ttl": "10m"}, "vip": {"ttl": "1h", "idle_timeout": "15m", "max_sessions": -1}},
+//	 "customers": {"42": "vip"}}
+//
+// Fields a tier leaves out use the server defaults; "max_sessions": -1 and
+// "idle_timeout": "-1s" lift the limit for the tier.
+func LoadTierPolicies(path string) (*TierPolicies, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file tierPolicyFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	policies := &TierPolicies{
+		DefaultTier: file.DefaultTier,
+		Tiers:       make(map[string]Policy, len(file.Tiers)),
+		Customers:   make(map[int]string, len(file.Customers)),
+	}
+	for name, tier := range file.Tiers {
+		policy := Policy{MaxSessions: tier.MaxSessions}
+		if policy.TTL, err = parseDuration(tier.TTL); err != nil {
+			return nil, fmt.Errorf("tier %s ttl: %w", name, err)
+		}
+		if policy.IdleTimeout, err = parseDuration(tier.IdleTimeout); err != nil {
+			return nil, fmt.Errorf("tier %s idle_timeout: %w", name, err)
+		}
+		policies.Tiers[name] = policy
+	}
+	if _, ok := policies.Tiers[policies.DefaultTier]; policies.DefaultTier != "" && !ok {
+		return nil, fmt.Errorf("default tier %s is not defined", policies.DefaultTier)
+	}
+	for id, tier := range file.Customers {
+		customerID, err := strconv.Atoi(id)
+		if err != nil {
+			return nil, fmt.Errorf("customer id %q: %w", id, err)
+		}
+		if _, ok := policies.Tiers[tier]; !ok {
+			return nil, fmt.Errorf("customer %d has unknown tier %s", customerID, tier)
+		}
+		policies.Customers[customerID] = tier
+	}
+	return policies, nil
+}
+
+func parseDuration(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(value)
+}
@@ -0,0 +1,83 @@
+package session
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadTierPolicies(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tiers.json")
+	config := `{
+		"default_tier": "standard",
+		"tiers": {
+			"standard": {"ttl": "10m", "max_sessions": 1},
+			"vip": {"ttl": "1h", "idle_timeout": "15m", "max_sessions": 3}
+		},
+		"customers": {"42": "vip"}
+	}`
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	policies, err := LoadTierPolicies(path)
+	if err != nil {
+		t.Fatalf("LoadTierPolicies: %v", err)
+	}
+	if policy := policies.PolicyFor(42); policy.TTL != time.Hour || policy.IdleTimeout != 15*time.Minute || policy.MaxSessions != 3 {
+		t.Errorf("Unexpected vip policy %+v", policy)
+	}
+	if policy := policies.PolicyFor(1); policy.TTL != 10*time.Minute || policy.MaxSessions != 1 {
+		t.Errorf("Unexpected standard policy %+v", policy)
+	}
+
+	os.WriteFile(path, []byte(`{"tiers": {}, "customers": {"1": "gold"}}`), 0o600)
+	if _, err := LoadTierPolicies(path); err == nil {
+		t.Errorf("Expected error for unknown tier")
+	}
+}
+
+func TestTierSessions(t *testing.T) {
+	policies := &TierPolicies{
+		DefaultTier: "standard",
+		Tiers: map[string]Policy{
+			"standard": {MaxSessions: 1},
+			"vip":      {TTL: time.Hour, IdleTimeout: time.Minute, MaxSessions: 2},
+			"partner":  {MaxSessions: -1},
+		},
+		Customers: map[int]string{42: "vip", 7: "partner"},
+	}
+	sessionManager := NewSessionManager(WithPolicyProvider(policies))
+
+	standard := sessionManager.GetSession(1)
+	if ttl := standard.ExpiryTime.Sub(standard.CreatedTime); ttl != sessionTimeoutMins*time.Minute {
+		t.Errorf("Expected default TTL for standard tier, got %v", ttl)
+	}
+	sessionManager.Issue(1, IssueOptions{Device: "phone"})
+	if len(sessionManager.Sessions(1)) != 1 {
+		t.Errorf("Expected standard tier to keep a single session")
+	}
+
+	vip := sessionManager.GetSession(42)
+	if ttl := vip.ExpiryTime.Sub(vip.CreatedTime); ttl != time.Hour {
+		t.Errorf("Expected vip TTL of an hour, got %v", ttl)
+	}
+	sessionManager.Issue(42, IssueOptions{Device: "phone"})
+	if len(sessionManager.Sessions(42)) != 2 {
+		t.Errorf("Expected vip tier to keep two sessions")
+	}
+
+	for _, device := range []string{"a", "b", "c", "d", "e", "f"} {
+		sessionManager.Issue(7, IssueOptions{Device: device})
+	}
+	if len(sessionManager.Sessions(7)) != 6 {
+		t.Errorf("Expected a negative max_sessions to lift the default limit")
+	}
+
+	// 空闲超时之后过期
+	vip.LastUsedTime = time.Now().Add(-2 * time.Minute)
+	sessionManager.store.Put(vip)
+	if _, err := sessionManager.Authenticate(vip.SessionKey, Fingerprint{}); err != ErrSessionExpired {
+		t.Errorf("Expected idle session to expire, got %v", err)
+	}
+}
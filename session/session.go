@@ -1,124 +1,578 @@
 package session
 
 import (
-	"math/rand"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"sync"
 	"time"
 
 	"log"
 )
 
-const sessionTimeoutMins = 10
+const (
+	sessionTimeoutMins = 10
+	maxKeyAttempts     = 10
+	defaultMaxLifetime = time.Hour
+	defaultMaxSessions = 5
+	sessionShards      = 64
+)
 
 type Session struct {
-	SessionKey string    `json:"session_key"`
-	ExpiryTime time.Time `json:"expiry_time"`
+	CustomerID  int          `json:"customer_id"`
+	SessionKey  string       `json:"session_key"`
+	Device      string       `json:"device,omitempty"`
+	Binding     *Fingerprint `json:"-"` // 创建时绑定的客户端，不返回给客户端
+	CreatedTime time.Time    `json:"created_time"`
+	ExpiryTime  time.Time    `json:"expiry_time"`
+	// 空闲超时，LastUsedTime 之后这么久没有使用也算过期
+	IdleTimeout  time.Duration `json:"idle_timeout,omitempty"`
+	LastUsedTime time.Time     `json:"last_used_time"`
 }
 
 func (s *Session) IsExpired() bool {
-	return time.Now().After(s.ExpiryTime)
+	return s.expiredAt(time.Now())
+}
+
+// KeyID returns a short hash of the session key, enough to tell sessions apart in
+// logs and records without storing a credential that can be replayed.
+func (s *Session) KeyID() string {
+	sum := sha256.Sum256([]byte(s.SessionKey))
+	return hex.EncodeToString(sum[:8])
+}
+
+// TTL returns how long the session has left, zero once it has expired.
+func (s *Session) TTL() time.Duration {
+	if ttl := time.Until(s.Deadline()); ttl > 0 {
+		return ttl
+	}
+	return 0
+}
+
+func (s *Session) expiredAt(now time.Time) bool {
+	return now.After(s.Deadline())
+}
+
+// Deadline is when the session really ends: the earlier of ExpiryTime and the idle timeout.
+func (s *Session) Deadline() time.Time {
+	if s.IdleTimeout > 0 && !s.LastUsedTime.IsZero() {
+		if idle := s.LastUsedTime.Add(s.IdleTimeout); idle.Before(s.ExpiryTime) {
+			return idle
+		}
+	}
+	return s.ExpiryTime
 }
 
 type SessionManager struct {
-	SessionsByCustomerID sync.Map // customerId -> *Session
-	SessionsBySessionKey sync.Map // sessionKey -> string
-	mu                   sync.RWMutex
+	store         SessionStore
+	keyGenerator  KeyGenerator
+	defaultPolicy Policy
+	policies      PolicyProvider
+	slidingExpiry bool
+	maxLifetime   time.Duration // 从创建开始算，session 最长的存活时间
+	binding       BindingPolicy
+	events        eventHub
+	// 设置之后使用无状态的签名 token，不再保存 session
+	tokens        *TokenSigner
+	revokedTokens Denylist
+	// 按客户 ID 分片加锁，不同客户的 session 操作互不阻塞
+	shards   [sessionShards]sync.RWMutex
+	reserved sync.Map // 正在创建的 session key，避免不同分片生成相同的 key
+}
+
+type Option func(*SessionManager)
+
+// WithStore replaces the default in-memory store.
+func WithStore(store SessionStore) Option {
+	return func(m *SessionManager) {
+		m.store = store
+	}
+}
+
+// WithKeyGenerator replaces the default crypto/rand key generator.
+func WithKeyGenerator(generator KeyGenerator) Option {
+	return func(m *SessionManager) {
+		m.keyGenerator = generator
+	}
+}
+
+// WithSlidingExpiry extends a session by its TTL every time GetCustomerID accepts it.
+func WithSlidingExpiry() Option {
+	return func(m *SessionManager) {
+		m.slidingExpiry = true
+	}
+}
+
+// WithMaxLifetime caps how long a session can be extended past its creation.
+func WithMaxLifetime(maxLifetime time.Duration) Option {
+	return func(m *SessionManager) {
+		m.maxLifetime = maxLifetime
+	}
+}
+
+// WithMaxSessionsPerCustomer limits how many devices a customer can hold sessions on, 0 for no limit.
+func WithMaxSessionsPerCustomer(max int) Option {
+	return func(m *SessionManager) {
+		m.defaultPolicy.MaxSessions = max
+	}
+}
+
+// WithTTL sets how long a new session lives when the customer's policy does not say.
+func WithTTL(ttl time.Duration) Option {
+	return func(m *SessionManager) {
+		m.defaultPolicy.TTL = ttl
+	}
+}
+
+// WithPolicyProvider resolves TTL, idle timeout and session limit per customer.
+func WithPolicyProvider(provider PolicyProvider) Option {
+	return func(m *SessionManager) {
+		m.policies = provider
+	}
 }
 
-func NewSessionManager() *SessionManager {
-	return &SessionManager{
-		SessionsByCustomerID: sync.Map{},
-		SessionsBySessionKey: sync.Map{},
+// WithBindingPolicy binds new sessions to the client fingerprint they were issued to.
+func WithBindingPolicy(policy BindingPolicy) Option {
+	return func(m *SessionManager) {
+		m.binding = policy
+	}
+}
+
+// WithTokenSigner switches to stateless mode: session keys are signed tokens that
+// any process sharing the signing keys can validate. Tokens cannot be looked up per
+// customer, so device reuse and session limits do not apply, and sliding expiry
+// needs an explicit Refresh that hands out a new token. Revocations are kept in a
+// MemoryDenylist local to this process unless WithDenylist shares one between them.
+func WithTokenSigner(signer *TokenSigner) Option {
+	return func(m *SessionManager) {
+		m.tokens = signer
+	}
+}
+
+// WithDenylist replaces the in-memory list of revoked tokens. Processes sharing the
+// signing keys need a shared Denylist too, or a token revoked on one is still
+// accepted by the others.
+func WithDenylist(denylist Denylist) Option {
+	return func(m *SessionManager) {
+		m.revokedTokens = denylist
+	}
+}
+
+func NewSessionManager(opts ...Option) *SessionManager {
+	generator, _ := NewRandomKeyGenerator(DefaultKeyLength, DefaultKeyAlphabet)
+	m := &SessionManager{
+		store:        NewMemoryStore(),
+		keyGenerator: generator,
+		defaultPolicy: Policy{
+			TTL:         sessionTimeoutMins * time.Minute,
+			MaxSessions: defaultMaxSessions,
+		},
+		maxLifetime:   defaultMaxLifetime,
+		binding:       DefaultBindingPolicy(),
+		revokedTokens: NewMemoryDenylist(),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// policyFor returns the customer's policy with unset fields taken from the defaults.
+func (m *SessionManager) policyFor(customerID int) Policy {
+	if m.policies == nil {
+		return m.defaultPolicy
+	}
+	policy := m.policies.PolicyFor(customerID)
+	if policy.TTL <= 0 {
+		policy.TTL = m.defaultPolicy.TTL
+	}
+	// 0 沿用默认值，负数表示这个等级不限制
+	switch {
+	case policy.IdleTimeout == 0:
+		policy.IdleTimeout = m.defaultPolicy.IdleTimeout
+	case policy.IdleTimeout < 0:
+		policy.IdleTimeout = 0
+	}
+	switch {
+	case policy.MaxSessions == 0:
+		policy.MaxSessions = m.defaultPolicy.MaxSessions
+	case policy.MaxSessions < 0:
+		policy.MaxSessions = 0
 	}
+	return policy
 }
+
+// IssueOptions describe the session a customer is asking for.
+type IssueOptions struct {
+	Device      string // 设备标签，同一个设备复用同一个 session
+	Fingerprint Fingerprint
+}
+
 func (m *SessionManager) GetSession(customerID int) *Session {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	sessionValue, ok := m.SessionsByCustomerID.Load(customerID)
-	log.Printf(" get session  %t in sessionmap,", ok)
-	if ok {
-		session := sessionValue.(*Session)
+	return m.Issue(customerID, IssueOptions{})
+}
+
+// Issue returns the customer's live session for opts.Device, creating one if needed.
+// When the customer already has the maximum number of sessions the oldest is evicted.
+// Like Authenticate it returns a copy, so changing it does not change the stored session.
+func (m *SessionManager) Issue(customerID int, opts IssueOptions) *Session {
+	if m.tokens != nil {
+		return m.issueToken(customerID, opts)
+	}
+	lock := m.shard(customerID)
+	lock.Lock()
+	defer lock.Unlock()
+	sessions := m.store.GetByCustomerID(customerID)
+	log.Printf(" get session  %d in sessionmap,", len(sessions))
+	live := make([]*Session, 0, len(sessions))
+	for _, session := range sessions {
 		if session.IsExpired() {
 			log.Printf(" expire")
 
-			m.SessionsByCustomerID.Delete(customerID)
-			m.SessionsBySessionKey.Delete(session.SessionKey)
-		} else {
+			m.store.Delete(session)
+			m.events.publish(EventExpired, session)
+			continue
+		}
+		if session.Device == opts.Device && m.reusable(session, opts.Fingerprint) {
 			log.Printf(" not expire")
 
-			return session
+			copied := *session
+			return &copied
 		}
+		live = append(live, session)
+	}
+	policy := m.policyFor(customerID)
+	// live 按创建时间排序，最老的在前面
+	for policy.MaxSessions > 0 && len(live) >= policy.MaxSessions {
+		log.Printf(" evict oldest session of customer %d", customerID)
+		m.store.Delete(live[0])
+		m.events.publish(EventRevoked, live[0])
+		live = live[1:]
 	}
+
+	now := time.Now()
 	newSession := &Session{
-		SessionKey: m.generateSessionKey(),
-		ExpiryTime: time.Now().Add(time.Duration(sessionTimeoutMins) * time.Second),
+		CustomerID:   customerID,
+		SessionKey:   m.generateSessionKey(),
+		Device:       opts.Device,
+		Binding:      m.binding.bind(opts.Fingerprint),
+		CreatedTime:  now,
+		ExpiryTime:   m.capLifetime(now, now.Add(policy.TTL)),
+		IdleTimeout:  policy.IdleTimeout,
+		LastUsedTime: now,
 	}
 	log.Printf(" key %s", newSession.SessionKey)
 
-	m.storeSession(customerID, newSession)
+	m.store.Put(newSession)
+	m.reserved.Delete(newSession.SessionKey)
+	m.events.publish(EventCreated, newSession)
 	log.Printf(" susccess")
 
-	return newSession
+	copied := *newSession
+	return &copied
 }
 
-func (m *SessionManager) storeSession(customerID int, session *Session) {
-	m.SessionsByCustomerID.Store(customerID, session)
-	m.SessionsBySessionKey.Store(session.SessionKey, customerID)
+// Sessions returns copies of the customer's live sessions, oldest first.
+func (m *SessionManager) Sessions(customerID int) []*Session {
+	lock := m.shard(customerID)
+	lock.RLock()
+	defer lock.RUnlock()
 
+	live := make([]*Session, 0)
+	for _, session := range m.store.GetByCustomerID(customerID) {
+		if !session.IsExpired() {
+			copied := *session
+			live = append(live, &copied)
+		}
+	}
+	return live
 }
 
+// GetCustomerID authenticates sessionKey without a client fingerprint, so sessions
+// bound under BindingEnforce are rejected.
 func (m *SessionManager) GetCustomerID(sessionKey string) (int, bool) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-
-	customerIDValue, ok := m.SessionsBySessionKey.Load(sessionKey)
-	if !ok {
+	session, err := m.Authenticate(sessionKey, Fingerprint{})
+	if err != nil {
 		return -1, false
 	}
-	sessionValue, ok := m.SessionsByCustomerID.Load(customerIDValue)
-	if ok {
-		session := sessionValue.(*Session)
-		if session.IsExpired() {
-			log.Printf(" this session key is expire")
-			return -1, false
-		}
+	return session.CustomerID, true
+}
 
+// Authenticate checks sessionKey for a stake request from the client fp, sliding its
+// expiry when enabled. The returned session is a copy that is safe to read without locking.
+func (m *SessionManager) Authenticate(sessionKey string, fp Fingerprint) (*Session, error) {
+	if m.tokens != nil {
+		return m.authenticateToken(sessionKey, fp)
 	}
+	// 需要修改过期时间时用写锁
+	mutates := m.mutatesOnUse()
+	session, unlock := m.lockKey(sessionKey, mutates)
+	defer unlock()
+	if session == nil {
+		return nil, ErrSessionNotFound
+	}
+	if session.IsExpired() {
+		log.Printf(" this session key is expire")
+		return nil, ErrSessionExpired
+	}
+	if err := m.checkBinding(session, fp); err != nil {
+		return nil, err
+	}
+	if mutates {
+		session = m.touch(session, time.Now())
+	}
+
+	copied := *session
+	return &copied, nil
+}
+
+// mutatesOnUse reports whether Authenticate has to update the session it accepts.
+func (m *SessionManager) mutatesOnUse() bool {
+	return m.slidingExpiry || m.policies != nil || m.defaultPolicy.IdleTimeout > 0
+}
+
+// touch records a use of the session and returns the stored version. It must be
+// called with the session's shard locked for writing.
+func (m *SessionManager) touch(session *Session, now time.Time) *Session {
+	if !m.slidingExpiry && session.IdleTimeout <= 0 {
+		return session
+	}
+	// 存储里的 session 不在原地修改，复制一份再存回去
+	updated := *session
+	if m.slidingExpiry {
+		m.extend(&updated, now)
+	}
+	updated.LastUsedTime = now
+	m.store.Put(&updated)
+	if m.slidingExpiry {
+		m.events.publish(EventRefreshed, &updated)
+	}
+	return &updated
+}
+
+func (m *SessionManager) checkBinding(session *Session, fp Fingerprint) error {
+	if m.binding.matches(session.Binding, fp) {
+		return nil
+	}
+	log.Printf("session of customer %d used from a different client %s", session.CustomerID, fp.IP)
+	if m.binding.Mode == BindingEnforce {
+		return ErrFingerprintMismatch
+	}
+	return nil
+}
 
-	return customerIDValue.(int), true
+// reusable reports whether an existing session can be handed to the client fp.
+func (m *SessionManager) reusable(session *Session, fp Fingerprint) bool {
+	return m.binding.Mode != BindingEnforce || m.binding.matches(session.Binding, fp)
 }
 
-func (m *SessionManager) SessionCleanup() {
+// Lookup returns a copy of the live session for sessionKey without extending it.
+// Under BindingEnforce only the client fp the session is bound to can look it up.
+func (m *SessionManager) Lookup(sessionKey string, fp Fingerprint) (*Session, bool) {
+	if m.tokens != nil {
+		session, _, err := m.parseToken(sessionKey)
+		return session, err == nil && m.checkBinding(session, fp) == nil
+	}
+	session, unlock := m.lockKey(sessionKey, false)
+	defer unlock()
+	if session == nil || session.IsExpired() || m.checkBinding(session, fp) != nil {
+		return nil, false
+	}
+	copied := *session
+	return &copied, true
+}
+
+// Refresh extends the customer's live session, which must match sessionKey.
+func (m *SessionManager) Refresh(customerID int, sessionKey string, fp Fingerprint) (*Session, bool) {
+	if m.tokens != nil {
+		return m.refreshToken(customerID, sessionKey, fp)
+	}
+	lock := m.shard(customerID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	session, ok := m.store.GetBySessionKey(sessionKey)
+	if !ok || session.CustomerID != customerID || session.IsExpired() {
+		return nil, false
+	}
+	if m.checkBinding(session, fp) != nil {
+		return nil, false
+	}
+	now := time.Now()
+	updated := *session
+	updated.LastUsedTime = now
+	m.extend(&updated, now)
+	m.store.Put(&updated)
+	m.events.publish(EventRefreshed, &updated)
+	return &updated, true
+}
+
+// Revoke removes all of the customer's sessions immediately. It reports whether any existed.
+func (m *SessionManager) Revoke(customerID int) bool {
+	if m.tokens != nil {
+		// 无法知道客户有没有 token，只能让之前签发的全部失效
+		m.revokedTokens.RevokeCustomer(customerID, time.Now())
+		log.Printf("Revoked all tokens for customer: %d", customerID)
+		return true
+	}
+	lock := m.shard(customerID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	sessions := m.store.GetByCustomerID(customerID)
+	for _, session := range sessions {
+		m.store.Delete(session)
+		m.events.publish(EventRevoked, session)
+	}
+	log.Printf("Revoked %d sessions for customer: %d", len(sessions), customerID)
+	return len(sessions) > 0
+}
+
+// RevokeKey removes the session with the given key immediately. It reports whether one existed.
+func (m *SessionManager) RevokeKey(sessionKey string) bool {
+	if m.tokens != nil {
+		return m.revokeToken(sessionKey)
+	}
+	session, unlock := m.lockKey(sessionKey, true)
+	defer unlock()
+	if session == nil {
+		return false
+	}
+	m.store.Delete(session)
+	m.events.publish(EventRevoked, session)
+	log.Printf("Revoked session for customer: %d", session.CustomerID)
+	return true
+}
+
+// extend moves the expiry of a copy of a stored session, which the caller then Puts.
+func (m *SessionManager) extend(session *Session, now time.Time) {
+	expiry := m.capLifetime(session.CreatedTime, now.Add(m.policyFor(session.CustomerID).TTL))
+	if expiry.After(session.ExpiryTime) {
+		session.ExpiryTime = expiry
+	}
+}
+
+// capLifetime returns expiry, moved back to the end of the maximum lifetime of a
+// session created at created.
+func (m *SessionManager) capLifetime(created time.Time, expiry time.Time) time.Time {
+	if m.maxLifetime > 0 {
+		if limit := created.Add(m.maxLifetime); expiry.After(limit) {
+			return limit
+		}
+	}
+	return expiry
+}
+
+// SessionCleanup sweeps expired sessions every interval until ctx is cancelled.
+func (m *SessionManager) SessionCleanup(ctx context.Context, interval time.Duration) {
 	log.Printf("Session cleanup started.")
-	ticker := time.NewTicker(1 * time.Minute)
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	for {
-		log.Printf("Waiting for next tick...")
-		<-ticker.C
-		log.Printf("session clean here")
+		select {
+		case <-ctx.Done():
+			log.Printf("Session cleanup stopped.")
+			return
+		case now := <-ticker.C:
+			evicted := m.Sweep(now)
+			log.Printf("session cleanup evicted %d sessions", evicted)
+		}
+	}
+}
+
+// Sweep deletes every session expired at now and returns how many were deleted.
+// In token mode there are no sessions to delete, so it prunes the denylist and returns 0.
+func (m *SessionManager) Sweep(now time.Time) int {
+	if m.tokens != nil {
+		// token 模式下没有 session 需要删除，只清理已经过期的撤销记录
+		if pruned := m.pruneRevoked(now); pruned > 0 {
+			log.Printf("session cleanup pruned %d revoked tokens", pruned)
+		}
+		return 0
+	}
+	var expired []*Session
+	m.store.RangeExpired(now, func(session *Session) bool {
+		expired = append(expired, session)
+		return true
+	})
+	evicted := 0
+	for _, candidate := range expired {
+		// 加锁后重新检查，session 可能已经被延长或删除
+		session, unlock := m.lockKey(candidate.SessionKey, true)
+		if session != nil && session.expiredAt(now) {
+			m.store.Delete(session)
+			m.events.publish(EventExpired, session)
+			log.Printf("Deleted session for customer: %v\n", session.CustomerID)
+			evicted++
+		}
+		unlock()
+	}
+	return evicted
+}
+
+// pruneRevoked drops denylist entries that can no longer match a live token and returns how many.
+func (m *SessionManager) pruneRevoked(now time.Time) int {
+	return m.revokedTokens.Prune(now, m.maxLifetime)
+}
 
-		// Session cleanup logic
-		m.SessionsByCustomerID.Range(func(key, value interface{}) bool {
-			log.Printf("session clean here start range %d", key)
+func (m *SessionManager) shard(customerID int) *sync.RWMutex {
+	return &m.shards[shardIndex(customerID, sessionShards)]
+}
 
-			session := value.(*Session)
-			if session.IsExpired() {
-				m.SessionsByCustomerID.Delete(key)
-				m.SessionsBySessionKey.Delete(session.SessionKey)
-				log.Printf("Deleted session for customer: %v\n", key)
-			}
-			return true
-		})
+// lockKey finds the session for sessionKey and locks its customer's shard, returning
+// nil when there is no such session. The caller must always call unlock.
+func (m *SessionManager) lockKey(sessionKey string, write bool) (*Session, func()) {
+	session, ok := m.store.GetBySessionKey(sessionKey)
+	if !ok {
+		return nil, func() {}
+	}
+	lock := m.shard(session.CustomerID)
+	unlock := lock.RUnlock
+	if write {
+		lock.Lock()
+		unlock = lock.Unlock
+	} else {
+		lock.RLock()
 	}
+	// 加锁之前 session 可能被删除或替换
+	session, ok = m.store.GetBySessionKey(sessionKey)
+	if !ok {
+		return nil, unlock
+	}
+	return session, unlock
+}
+
+// shardIndex spreads customer IDs over n shards.
+func shardIndex(customerID int, n int) int {
+	return int((uint64(customerID) * 0x9E3779B97F4A7C15 >> 32) % uint64(n))
 }
 
+// generateSessionKey reserves the key it returns; the caller releases the reservation
+// from m.reserved once the session is stored.
 func (m *SessionManager) generateSessionKey() string {
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
-	b := make([]byte, 20)
-	for i := range b {
-		const chars = "abcdefghijklmnopqrstuvwxyz0123456789"
-		b[i] = chars[r.Intn(len(chars))]
+	for i := 0; i < maxKeyAttempts; i++ {
+		key, err := m.keyGenerator.GenerateKey()
+		if err != nil {
+			log.Printf("generate session key failed: %v", err)
+			continue
+		}
+		if _, ok := m.store.GetBySessionKey(key); ok {
+			log.Printf("session key collision, retrying")
+			continue
+		}
+		if _, loaded := m.reserved.LoadOrStore(key, struct{}{}); loaded {
+			log.Printf("session key collision, retrying")
+			continue
+		}
+		// 预留之后再检查一次，防止另一个分片刚好存入并释放了同一个 key
+		if _, ok := m.store.GetBySessionKey(key); ok {
+			m.reserved.Delete(key)
+			log.Printf("session key collision, retrying")
+			continue
+		}
+		return key
 	}
-	return string(b)
+	log.Panicf("could not generate a unique session key after %d attempts", maxKeyAttempts)
+	return ""
 }
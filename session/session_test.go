@@ -1,6 +1,7 @@
 package session
 
 import (
+	"context"
 	"sync"
 	"testing"
 	"time"
@@ -17,27 +18,187 @@ func TestGetSession(t *testing.T) {
 
 	// 测试获取已存在的 session
 	session1 := sessionManager.GetSession(1)
-	if session1 != session {
+	if session1.SessionKey != session.SessionKey {
 		t.Errorf("Expected the same session, got different sessions")
 	}
 
 	// 测试获取过期的 session
 	session.ExpiryTime = time.Now().Add(-time.Minute)
+	sessionManager.store.Put(session)
 	session2 := sessionManager.GetSession(1)
-	if session2 == session {
+	if session2.SessionKey == session.SessionKey {
 		t.Errorf("Expected a new session, got the same expired session")
 	}
 
-	// 测试并发获取 session
+	// 测试并发获取 session，key 不能重复
+	keys := sync.Map{}
 	wg := sync.WaitGroup{}
 	for i := 0; i < 100; i++ {
 		wg.Add(1)
 		go func(id int) {
 			defer wg.Done()
 			time.Sleep(3 * time.Second)
-			sessionManager.GetSession(id)
+			session := sessionManager.GetSession(id)
+			if other, loaded := keys.LoadOrStore(session.SessionKey, id); loaded && other != id {
+				t.Errorf("Customers %d and %v got the same key %s", id, other, session.SessionKey)
+			}
 		}(i)
 	}
 	wg.Wait()
 
 }
+
+func TestSlidingExpiry(t *testing.T) {
+	sessionManager := NewSessionManager(WithSlidingExpiry(), WithMaxLifetime(time.Minute))
+	session := sessionManager.GetSession(1)
+
+	// 每次使用都会延长过期时间
+	session.ExpiryTime = time.Now().Add(time.Second)
+	sessionManager.store.Put(session)
+	if _, ok := sessionManager.GetCustomerID(session.SessionKey); !ok {
+		t.Fatalf("Expected session to be valid")
+	}
+	extended, _ := sessionManager.Lookup(session.SessionKey, Fingerprint{})
+	if time.Until(extended.ExpiryTime) <= time.Second {
+		t.Errorf("Expected expiry to slide forward, got %v", extended.ExpiryTime)
+	}
+
+	// 不能超过最长存活时间
+	extended.CreatedTime = time.Now().Add(-time.Minute + time.Second)
+	extended.ExpiryTime = time.Now().Add(500 * time.Millisecond)
+	sessionManager.store.Put(extended)
+	sessionManager.GetCustomerID(session.SessionKey)
+	capped, _ := sessionManager.Lookup(session.SessionKey, Fingerprint{})
+	if limit := extended.CreatedTime.Add(time.Minute); capped.ExpiryTime.After(limit) {
+		t.Errorf("Expected expiry capped at %v, got %v", limit, capped.ExpiryTime)
+	}
+
+	// 新 session 的有效期也不能超过最长存活时间
+	long := NewSessionManager(WithTTL(time.Hour), WithMaxLifetime(time.Minute)).GetSession(1)
+	if lifetime := long.ExpiryTime.Sub(long.CreatedTime); lifetime != time.Minute {
+		t.Errorf("Expected a new session capped at the max lifetime, got %v", lifetime)
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	sessionManager := NewSessionManager()
+	session := sessionManager.GetSession(1)
+	session.ExpiryTime = time.Now().Add(time.Second)
+	sessionManager.store.Put(session)
+
+	if _, ok := sessionManager.Refresh(2, session.SessionKey, Fingerprint{}); ok {
+		t.Errorf("Expected refresh with another customer's key to fail")
+	}
+	refreshed, ok := sessionManager.Refresh(1, session.SessionKey, Fingerprint{})
+	if !ok || time.Until(refreshed.ExpiryTime) <= time.Second {
+		t.Errorf("Expected refreshed session, got %v %t", refreshed, ok)
+	}
+
+	// 非滑动模式下使用 session 不会延长
+	sessionManager.GetCustomerID(session.SessionKey)
+	if current, _ := sessionManager.Lookup(session.SessionKey, Fingerprint{}); !current.ExpiryTime.Equal(refreshed.ExpiryTime) {
+		t.Errorf("Expected expiry unchanged without sliding mode")
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	sessionManager := NewSessionManager()
+	session := sessionManager.GetSession(1)
+	if !sessionManager.Revoke(1) {
+		t.Errorf("Expected revoke to find the session")
+	}
+	if _, ok := sessionManager.GetCustomerID(session.SessionKey); ok {
+		t.Errorf("Expected revoked session key to be rejected")
+	}
+	if sessionManager.Revoke(1) {
+		t.Errorf("Expected second revoke to find nothing")
+	}
+
+	session = sessionManager.GetSession(2)
+	if !sessionManager.RevokeKey(session.SessionKey) {
+		t.Errorf("Expected revoke by key to find the session")
+	}
+	if _, ok := sessionManager.GetCustomerID(session.SessionKey); ok {
+		t.Errorf("Expected revoked session key to be rejected")
+	}
+	if next := sessionManager.GetSession(2); next.SessionKey == session.SessionKey {
+		t.Errorf("Expected a new key after revoke")
+	}
+}
+
+func TestDeviceSessions(t *testing.T) {
+	sessionManager := NewSessionManager(WithMaxSessionsPerCustomer(2))
+	phone := sessionManager.Issue(1, IssueOptions{Device: "phone"})
+	desktop := sessionManager.Issue(1, IssueOptions{Device: "desktop"})
+	if phone.SessionKey == desktop.SessionKey {
+		t.Fatalf("Expected different keys per device")
+	}
+	if again := sessionManager.Issue(1, IssueOptions{Device: "phone"}); again.SessionKey != phone.SessionKey {
+		t.Errorf("Expected the same device to reuse its session")
+	}
+	for _, session := range []*Session{phone, desktop} {
+		if customerID, ok := sessionManager.GetCustomerID(session.SessionKey); !ok || customerID != 1 {
+			t.Errorf("Expected key %s to belong to customer 1", session.SessionKey)
+		}
+	}
+
+	// 超过上限时淘汰最老的 session
+	tablet := sessionManager.Issue(1, IssueOptions{Device: "tablet"})
+	if _, ok := sessionManager.GetCustomerID(phone.SessionKey); ok {
+		t.Errorf("Expected oldest session to be evicted")
+	}
+	sessions := sessionManager.Sessions(1)
+	if len(sessions) != 2 || sessions[0].SessionKey != desktop.SessionKey || sessions[1].SessionKey != tablet.SessionKey {
+		t.Errorf("Expected desktop and tablet sessions, got %v", sessions)
+	}
+
+	if !sessionManager.Revoke(1) || len(sessionManager.Sessions(1)) != 0 {
+		t.Errorf("Expected revoke to remove every session of the customer")
+	}
+}
+
+func TestSessionCleanup(t *testing.T) {
+	sessionManager := NewSessionManager()
+	expired := sessionManager.GetSession(1)
+	expired.ExpiryTime = time.Now().Add(-time.Minute)
+	sessionManager.store.Put(expired)
+	sessionManager.GetSession(2)
+
+	if evicted := sessionManager.Sweep(time.Now()); evicted != 1 {
+		t.Errorf("Expected 1 evicted session, got %d", evicted)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		sessionManager.SessionCleanup(ctx, time.Millisecond)
+		close(done)
+	}()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Errorf("Expected SessionCleanup to return after cancel")
+	}
+}
+
+func TestLookup(t *testing.T) {
+	sessionManager := NewSessionManager(WithSlidingExpiry())
+	session := sessionManager.GetSession(1)
+	expiry := session.ExpiryTime
+
+	info, ok := sessionManager.Lookup(session.SessionKey, Fingerprint{})
+	if !ok || info.CustomerID != 1 || info.TTL() <= 0 {
+		t.Fatalf("Expected live session info, got %v %t", info, ok)
+	}
+	// Lookup 不会延长 session
+	if again, _ := sessionManager.Lookup(session.SessionKey, Fingerprint{}); !again.ExpiryTime.Equal(expiry) {
+		t.Errorf("Expected lookup not to slide expiry")
+	}
+
+	session.ExpiryTime = time.Now().Add(-time.Second)
+	sessionManager.store.Put(session)
+	if _, ok := sessionManager.Lookup(session.SessionKey, Fingerprint{}); ok {
+		t.Errorf("Expected expired session to be hidden")
+	}
+}
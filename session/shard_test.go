@@ -0,0 +1,92 @@
+package session
+
+import (
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestShardedConsistency(t *testing.T) {
+	sessionManager := NewSessionManager(WithSlidingExpiry(), WithMaxSessionsPerCustomer(2))
+	devices := []string{"phone", "desktop", "tablet"}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(seed))
+			for j := 0; j < 500; j++ {
+				customerID := r.Intn(20)
+				switch r.Intn(4) {
+				case 0, 1:
+					session := sessionManager.Issue(customerID, IssueOptions{Device: devices[r.Intn(len(devices))]})
+					sessionManager.Authenticate(session.SessionKey, Fingerprint{})
+				case 2:
+					sessionManager.Revoke(customerID)
+				case 3:
+					sessionManager.Sweep(time.Now())
+				}
+			}
+		}(int64(i))
+	}
+	wg.Wait()
+
+	// 两个索引必须一致
+	store := sessionManager.store.(*MemoryStore)
+	byCustomer := 0
+	store.SessionsByCustomerID.Range(func(key, value interface{}) bool {
+		sessions := value.([]*Session)
+		if len(sessions) > 2 {
+			t.Errorf("Customer %v has %d sessions, limit is 2", key, len(sessions))
+		}
+		for _, session := range sessions {
+			if indexed, ok := store.GetBySessionKey(session.SessionKey); !ok || indexed != session {
+				t.Errorf("Session %s of customer %v missing from key index", session.SessionKey, key)
+			}
+		}
+		byCustomer += len(sessions)
+		return true
+	})
+	byKey := 0
+	store.Range(func(session *Session) bool {
+		byKey++
+		return true
+	})
+	if byCustomer != byKey {
+		t.Errorf("Customer index has %d sessions, key index has %d", byCustomer, byKey)
+	}
+}
+
+// 用 -cpu 1,2,4,8 运行，比较不同 GOMAXPROCS 下的吞吐量
+func BenchmarkIssueParallel(b *testing.B) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	sessionManager := NewSessionManager()
+	var next atomic.Int64
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			sessionManager.GetSession(int(next.Add(1)))
+		}
+	})
+}
+
+func BenchmarkAuthenticateParallel(b *testing.B) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	sessionManager := NewSessionManager(WithSlidingExpiry())
+	keys := make([]string, 10000)
+	for i := range keys {
+		keys[i] = sessionManager.GetSession(i).SessionKey
+	}
+	var next atomic.Int64
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			sessionManager.Authenticate(keys[int(next.Add(1))%len(keys)], Fingerprint{})
+		}
+	})
+}
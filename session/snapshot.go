@@ -0,0 +1,79 @@
+package session
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Snapshot writes every live session to path, replacing the file atomically.
+func (m *SessionManager) Snapshot(path string) error {
+	now := time.Now()
+	var live []*Session
+	for _, session := range allSessions(m.store) {
+		if !session.expiredAt(now) {
+			live = append(live, session)
+		}
+	}
+	return writeSessions(path, live)
+}
+
+// Restore loads the non-expired sessions saved by Snapshot. A missing file is not an error.
+func (m *SessionManager) Restore(path string) (int, error) {
+	sessions, err := readSessions(path)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	restored := 0
+	for _, session := range sessions {
+		if session.expiredAt(now) {
+			continue
+		}
+		lock := m.shard(session.CustomerID)
+		lock.Lock()
+		if _, ok := m.store.GetBySessionKey(session.SessionKey); !ok {
+			m.store.Put(session)
+			restored++
+		}
+		lock.Unlock()
+	}
+	return restored, nil
+}
+
+// Flush writes out pending changes of a store that batches its writes, such as FileStore.
+func (m *SessionManager) Flush() error {
+	if flusher, ok := m.store.(Flusher); ok {
+		return flusher.Flush()
+	}
+	return nil
+}
+
+// SnapshotLoop writes a snapshot to path every interval, and once more when ctx is
+// cancelled. It flushes the store at the same times; path may be empty to only flush.
+func (m *SessionManager) SnapshotLoop(ctx context.Context, path string, interval time.Duration) {
+	log.Printf("Session snapshot started, path: %s", path)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	save := func() {
+		if path != "" {
+			if err := m.Snapshot(path); err != nil {
+				log.Printf("session snapshot failed: %v", err)
+			}
+		}
+		if err := m.Flush(); err != nil {
+			log.Printf("session store flush failed: %v", err)
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			save()
+			log.Printf("Session snapshot stopped.")
+			return
+		case <-ticker.C:
+			save()
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package session
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.json")
+	sessionManager := NewSessionManager()
+	live := sessionManager.GetSession(1)
+	expired := sessionManager.GetSession(2)
+	expired.ExpiryTime = time.Now().Add(-time.Minute)
+	sessionManager.store.Put(expired)
+
+	if err := sessionManager.Snapshot(path); err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+
+	restarted := NewSessionManager()
+	restored, err := restarted.Restore(path)
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if restored != 1 {
+		t.Errorf("Expected 1 restored session, got %d", restored)
+	}
+	if customerID, ok := restarted.GetCustomerID(live.SessionKey); !ok || customerID != 1 {
+		t.Errorf("Expected live session to be restored, got %d %t", customerID, ok)
+	}
+	if _, ok := restarted.GetCustomerID(expired.SessionKey); ok {
+		t.Errorf("Expected expired session not to be restored")
+	}
+
+	// 没有 snapshot 文件时直接启动
+	if _, err := NewSessionManager().Restore(filepath.Join(t.TempDir(), "missing.json")); err != nil {
+		t.Errorf("Expected missing snapshot to be ignored, got %v", err)
+	}
+
+	// 原子写入后不会留下临时文件
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("Expected only the snapshot file to remain, got %d entries", len(entries))
+	}
+}
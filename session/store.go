@@ -0,0 +1,265 @@
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SessionStore is the storage backend behind SessionManager.
+type SessionStore interface {
+	// GetByCustomerID returns every stored session of the customer, oldest first.
+	GetByCustomerID(customerID int) []*Session
+	GetBySessionKey(sessionKey string) (*Session, bool)
+	// Put adds the session, or replaces the stored one with the same key.
+	Put(session *Session)
+	Delete(session *Session)
+	// Range calls f for every stored session, stopping when f returns false.
+	Range(f func(session *Session) bool)
+	// RangeExpired calls f for every session expired at now, stopping when f returns false.
+	RangeExpired(now time.Time, f func(session *Session) bool)
+}
+
+const storeShards = 64
+
+// MemoryStore keeps sessions in two sync.Maps, one per lookup direction. Reads are
+// lock free; writes lock the customer's shard so both maps change together.
+// Stored sessions must not be modified in place, Put a copy instead.
+type MemoryStore struct {
+	SessionsByCustomerID sync.Map // customerId -> []*Session, replaced on every write
+	SessionsBySessionKey sync.Map // sessionKey -> *Session
+	shards               [storeShards]storeShard
+}
+
+type storeShard struct {
+	mu     sync.Mutex
+	expiry expiryIndex
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+func (s *MemoryStore) GetByCustomerID(customerID int) []*Session {
+	value, ok := s.SessionsByCustomerID.Load(customerID)
+	if !ok {
+		return nil
+	}
+	return value.([]*Session)
+}
+
+func (s *MemoryStore) GetBySessionKey(sessionKey string) (*Session, bool) {
+	value, ok := s.SessionsBySessionKey.Load(sessionKey)
+	if !ok {
+		return nil, false
+	}
+	return value.(*Session), true
+}
+
+func (s *MemoryStore) shard(customerID int) *storeShard {
+	return &s.shards[shardIndex(customerID, storeShards)]
+}
+
+func (s *MemoryStore) Put(session *Session) {
+	shard := s.shard(session.CustomerID)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	old := s.GetByCustomerID(session.CustomerID)
+	sessions := make([]*Session, 0, len(old)+1)
+	for _, current := range old {
+		if current.SessionKey != session.SessionKey {
+			sessions = append(sessions, current)
+		}
+	}
+	sessions = append(sessions, session)
+	sortByCreated(sessions)
+	s.SessionsByCustomerID.Store(session.CustomerID, sessions)
+	s.SessionsBySessionKey.Store(session.SessionKey, session)
+	shard.expiry.push(session)
+}
+
+func (s *MemoryStore) Delete(session *Session) {
+	shard := s.shard(session.CustomerID)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	old := s.GetByCustomerID(session.CustomerID)
+	sessions := make([]*Session, 0, len(old))
+	for _, current := range old {
+		if current.SessionKey != session.SessionKey {
+			sessions = append(sessions, current)
+		}
+	}
+	if len(sessions) == 0 {
+		s.SessionsByCustomerID.Delete(session.CustomerID)
+	} else {
+		s.SessionsByCustomerID.Store(session.CustomerID, sessions)
+	}
+	s.SessionsBySessionKey.Delete(session.SessionKey)
+}
+
+func (s *MemoryStore) Range(f func(session *Session) bool) {
+	s.SessionsBySessionKey.Range(func(key, value interface{}) bool {
+		return f(value.(*Session))
+	})
+}
+
+// RangeExpired only visits sessions whose indexed expiry has passed. Sessions that
+// are still stored afterwards, including ones extended in place, are indexed again.
+func (s *MemoryStore) RangeExpired(now time.Time, f func(session *Session) bool) {
+	visiting := true
+	for i := range s.shards {
+		shard := &s.shards[i]
+		var keep []*Session
+		for _, key := range shard.expiry.due(now) {
+			session, ok := s.GetBySessionKey(key)
+			if !ok {
+				continue
+			}
+			keep = append(keep, session)
+			if visiting && session.expiredAt(now) {
+				visiting = f(session)
+			}
+		}
+		for _, session := range keep {
+			if current, ok := s.GetBySessionKey(session.SessionKey); ok {
+				shard.expiry.push(current)
+			}
+		}
+	}
+}
+
+func sortByCreated(sessions []*Session) {
+	sort.SliceStable(sessions, func(i, j int) bool {
+		return sessions[i].CreatedTime.Before(sessions[j].CreatedTime)
+	})
+}
+
+func (s *MemoryStore) sessions() []*Session {
+	return allSessions(s)
+}
+
+func allSessions(store SessionStore) []*Session {
+	var result []*Session
+	store.Range(func(session *Session) bool {
+		result = append(result, session)
+		return true
+	})
+	return result
+}
+
+// Flusher is implemented by stores that batch their writes until Flush.
+type Flusher interface {
+	Flush() error
+}
+
+// FileStore is a MemoryStore backed by a file. Changes are batched: the file is
+// only rewritten by Flush, which SnapshotLoop calls every interval.
+type FileStore struct {
+	*MemoryStore
+	path  string
+	dirty atomic.Bool
+	mu    sync.Mutex // 同一时间只有一个 Flush 写文件
+}
+
+// NewFileStore opens the store at path, loading any sessions already saved there.
+func NewFileStore(path string) (*FileStore, error) {
+	store := &FileStore{MemoryStore: NewMemoryStore(), path: path}
+	sessions, err := readSessions(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, session := range sessions {
+		store.MemoryStore.Put(session)
+	}
+	return store, nil
+}
+
+func (s *FileStore) Put(session *Session) {
+	s.MemoryStore.Put(session)
+	s.dirty.Store(true)
+}
+
+func (s *FileStore) Delete(session *Session) {
+	s.MemoryStore.Delete(session)
+	s.dirty.Store(true)
+}
+
+// Flush writes the sessions to the file if anything changed since the last Flush.
+func (s *FileStore) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.dirty.Swap(false) {
+		return nil
+	}
+	if err := writeSessions(s.path, s.sessions()); err != nil {
+		s.dirty.Store(true) // 下次再试
+		return fmt.Errorf("write session file %s: %w", s.path, err)
+	}
+	return nil
+}
+
+// storedSession is a Session as written to disk. Binding is left out of the session's
+// own JSON so the API never returns it, but a restored session has to keep it.
+type storedSession struct {
+	Session
+	Binding *Fingerprint `json:"binding,omitempty"`
+}
+
+func readSessions(path string) ([]*Session, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var stored []storedSession
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, err
+	}
+	sessions := make([]*Session, 0, len(stored))
+	for i := range stored {
+		session := stored[i].Session
+		session.Binding = stored[i].Binding
+		sessions = append(sessions, &session)
+	}
+	return sessions, nil
+}
+
+// writeSessions writes to a temp file in the same directory and renames it over path,
+// so readers never see a half-written file.
+func writeSessions(path string, sessions []*Session) error {
+	stored := make([]storedSession, 0, len(sessions))
+	for _, session := range sessions {
+		stored = append(stored, storedSession{Session: *session, Binding: session.Binding})
+	}
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
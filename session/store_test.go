@@ -0,0 +1,106 @@
+package session
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Now()
+	session := &Session{CustomerID: 1, SessionKey: "a", CreatedTime: now, ExpiryTime: now.Add(time.Minute)}
+	store.Put(session)
+
+	if got := store.GetByCustomerID(1); len(got) != 1 || got[0] != session {
+		t.Errorf("Expected session by customer id, got %v", got)
+	}
+	if got, ok := store.GetBySessionKey("a"); !ok || got != session {
+		t.Errorf("Expected session by key, got %v %t", got, ok)
+	}
+
+	// 同一个客户可以有多个 session，按创建时间排序
+	older := &Session{CustomerID: 1, SessionKey: "b", CreatedTime: now.Add(-time.Hour), ExpiryTime: now.Add(-time.Minute)}
+	store.Put(older)
+	if got := store.GetByCustomerID(1); len(got) != 2 || got[0] != older {
+		t.Errorf("Expected two sessions oldest first, got %v", got)
+	}
+
+	// 相同 key 再次 Put 是替换
+	store.Put(session)
+	if got := store.GetByCustomerID(1); len(got) != 2 {
+		t.Errorf("Expected put with same key to replace, got %d sessions", len(got))
+	}
+
+	count := 0
+	store.RangeExpired(time.Now(), func(s *Session) bool {
+		count++
+		return true
+	})
+	if count != 1 {
+		t.Errorf("Expected 1 expired session, got %d", count)
+	}
+
+	store.Delete(older)
+	if _, ok := store.GetBySessionKey("b"); ok {
+		t.Errorf("Expected deleted key to be removed")
+	}
+	if got := store.GetByCustomerID(1); len(got) != 1 || got[0] != session {
+		t.Errorf("Expected deleting one session to keep the other, got %v", got)
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.json")
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	manager := NewSessionManager(WithStore(store))
+	session := manager.GetSession(7)
+
+	// 写入是批量的，Flush 之前文件里还没有
+	if sessions, _ := readSessions(path); len(sessions) != 0 {
+		t.Errorf("Expected no write before Flush, got %d sessions", len(sessions))
+	}
+	if err := manager.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	reopened, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("reopen NewFileStore: %v", err)
+	}
+	manager = NewSessionManager(WithStore(reopened))
+	customerID, ok := manager.GetCustomerID(session.SessionKey)
+	if !ok || customerID != 7 {
+		t.Errorf("Expected customer 7 after reload, got %d %t", customerID, ok)
+	}
+
+	reopened.Delete(session)
+	if err := reopened.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	reopened, err = NewFileStore(path)
+	if err != nil {
+		t.Fatalf("reopen NewFileStore: %v", err)
+	}
+	if _, ok := reopened.GetBySessionKey(session.SessionKey); ok {
+		t.Errorf("Expected deleted session to stay deleted after reload")
+	}
+}
+
+func TestSessionFileKeepsBinding(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.json")
+	bound := &Session{CustomerID: 1, SessionKey: "key", Binding: &Fingerprint{UserAgent: "phone"}}
+	if err := writeSessions(path, []*Session{bound}); err != nil {
+		t.Fatalf("writeSessions: %v", err)
+	}
+	sessions, err := readSessions(path)
+	if err != nil || len(sessions) != 1 {
+		t.Fatalf("readSessions: %v %v", sessions, err)
+	}
+	if sessions[0].Binding == nil || sessions[0].Binding.UserAgent != "phone" {
+		t.Errorf("Expected binding to survive a restart, got %+v", sessions[0].Binding)
+	}
+}
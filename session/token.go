@@ -0,0 +1,233 @@
+package session
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrInvalidToken = errors.New("invalid session token")
+
+// tokenClaims is the payload of a stateless session token.
+type tokenClaims struct {
+	KeyID      string       `json:"kid"`
+	TokenID    string       `json:"jti"`
+	CustomerID int          `json:"cid"`
+	Device     string       `json:"dev,omitempty"`
+	Binding    *Fingerprint `json:"bnd,omitempty"`
+	IssuedAt   int64        `json:"iat"` // unix 纳秒
+	CreatedAt  int64        `json:"crt"` // 第一次签发的时间，刷新后不变
+	ExpiresAt  int64        `json:"exp"`
+}
+
+// TokenSigner signs session tokens with HMAC-SHA256. Tokens name the key that
+// signed them, so a new key can be made active while tokens signed with older
+// keys stay valid until those keys are retired.
+type TokenSigner struct {
+	mu     sync.RWMutex
+	keys   map[string][]byte // keyId -> secret
+	active string
+}
+
+func NewTokenSigner(activeKeyID string, keys map[string]string) (*TokenSigner, error) {
+	signer := &TokenSigner{keys: make(map[string][]byte, len(keys))}
+	for keyID, secret := range keys {
+		if secret == "" {
+			return nil, fmt.Errorf("token key %s has an empty secret", keyID)
+		}
+		signer.keys[keyID] = []byte(secret)
+	}
+	if _, ok := signer.keys[activeKeyID]; !ok {
+		return nil, fmt.Errorf("active token key %s is not defined", activeKeyID)
+	}
+	signer.active = activeKeyID
+	return signer, nil
+}
+
+// LoadTokenSigner reads {"active": "k2", "keys": {"k1": "secret1", "k2": "secret2"}}.
+func LoadTokenSigner(path string) (*TokenSigner, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Active string            `json:"active"`
+		Keys   map[string]string `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return NewTokenSigner(file.Active, file.Keys)
+}
+
+// Rotate adds a key and signs new tokens with it.
+func (s *TokenSigner) Rotate(keyID string, secret string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[keyID] = []byte(secret)
+	s.active = keyID
+}
+
+// Retire removes a key; tokens signed with it are rejected from then on.
+func (s *TokenSigner) Retire(keyID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if keyID == s.active {
+		return errors.New("cannot retire the active token key")
+	}
+	delete(s.keys, keyID)
+	return nil
+}
+
+func (s *TokenSigner) sign(claims tokenClaims) (string, error) {
+	s.mu.RLock()
+	claims.KeyID = s.active
+	secret := s.keys[s.active]
+	s.mu.RUnlock()
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + tokenMAC(secret, encoded), nil
+}
+
+func (s *TokenSigner) verify(token string) (tokenClaims, error) {
+	var claims tokenClaims
+	encoded, mac, ok := strings.Cut(token, ".")
+	if !ok {
+		return claims, ErrInvalidToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return claims, ErrInvalidToken
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return claims, ErrInvalidToken
+	}
+	s.mu.RLock()
+	secret, ok := s.keys[claims.KeyID]
+	s.mu.RUnlock()
+	if !ok || !hmac.Equal([]byte(mac), []byte(tokenMAC(secret, encoded))) {
+		return claims, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+func tokenMAC(secret []byte, encoded string) string {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
+
+func (m *SessionManager) issueToken(customerID int, opts IssueOptions) *Session {
+	now := time.Now()
+	policy := m.policyFor(customerID)
+	session := &Session{
+		CustomerID:   customerID,
+		Device:       opts.Device,
+		Binding:      m.binding.bind(opts.Fingerprint),
+		CreatedTime:  now,
+		ExpiryTime:   m.capLifetime(now, now.Add(policy.TTL)), // 撤销记录只保留 maxLifetime，token 不能活得更久
+		LastUsedTime: now,
+	}
+	key, err := m.signToken(session, now)
+	if err != nil {
+		log.Panicf("sign session token failed: %v", err)
+	}
+	session.SessionKey = key
+	m.events.publish(EventCreated, session)
+	return session
+}
+
+func (m *SessionManager) signToken(session *Session, issuedAt time.Time) (string, error) {
+	tokenID := make([]byte, 16)
+	if _, err := rand.Read(tokenID); err != nil {
+		return "", err
+	}
+	return m.tokens.sign(tokenClaims{
+		TokenID:    hex.EncodeToString(tokenID),
+		CustomerID: session.CustomerID,
+		Device:     session.Device,
+		Binding:    session.Binding,
+		IssuedAt:   issuedAt.UnixNano(),
+		CreatedAt:  session.CreatedTime.UnixNano(),
+		ExpiresAt:  session.ExpiryTime.UnixNano(),
+	})
+}
+
+// parseToken verifies a token and returns the session it describes.
+func (m *SessionManager) parseToken(token string) (*Session, tokenClaims, error) {
+	claims, err := m.tokens.verify(token)
+	if err != nil {
+		return nil, claims, ErrSessionNotFound
+	}
+	session := &Session{
+		CustomerID:   claims.CustomerID,
+		SessionKey:   token,
+		Device:       claims.Device,
+		Binding:      claims.Binding,
+		CreatedTime:  time.Unix(0, claims.CreatedAt),
+		ExpiryTime:   time.Unix(0, claims.ExpiresAt),
+		LastUsedTime: time.Unix(0, claims.IssuedAt),
+	}
+	if m.revokedTokens.Revoked(claims.TokenID, claims.CustomerID, time.Unix(0, claims.IssuedAt)) {
+		return nil, claims, ErrSessionNotFound
+	}
+	if session.IsExpired() {
+		return nil, claims, ErrSessionExpired
+	}
+	return session, claims, nil
+}
+
+func (m *SessionManager) authenticateToken(token string, fp Fingerprint) (*Session, error) {
+	session, _, err := m.parseToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.checkBinding(session, fp); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// refreshToken issues a replacement token with a later expiry and revokes the old one.
+func (m *SessionManager) refreshToken(customerID int, token string, fp Fingerprint) (*Session, bool) {
+	session, claims, err := m.parseToken(token)
+	if err != nil || session.CustomerID != customerID || m.checkBinding(session, fp) != nil {
+		return nil, false
+	}
+	now := time.Now()
+	m.extend(session, now)
+	key, err := m.signToken(session, now)
+	if err != nil {
+		log.Printf("sign session token failed: %v", err)
+		return nil, false
+	}
+	m.revokedTokens.RevokeToken(claims.TokenID, time.Unix(0, claims.ExpiresAt))
+	session.SessionKey = key
+	session.LastUsedTime = now
+	m.events.publish(EventRefreshed, session)
+	return session, true
+}
+
+func (m *SessionManager) revokeToken(token string) bool {
+	session, claims, err := m.parseToken(token)
+	if err != nil {
+		return false
+	}
+	m.revokedTokens.RevokeToken(claims.TokenID, session.ExpiryTime)
+	m.events.publish(EventRevoked, session)
+	return true
+}
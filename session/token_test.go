@@ -0,0 +1,137 @@
+package session
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTokenManager(t *testing.T) (*SessionManager, *TokenSigner) {
+	signer, err := NewTokenSigner("k1", map[string]string{"k1": "secret1"})
+	if err != nil {
+		t.Fatalf("NewTokenSigner: %v", err)
+	}
+	return NewSessionManager(WithTokenSigner(signer)), signer
+}
+
+func TestTokenSessions(t *testing.T) {
+	sessionManager, signer := newTokenManager(t)
+	session := sessionManager.GetSession(7)
+
+	// 另一个进程只要有相同的密钥就能验证
+	other := NewSessionManager(WithTokenSigner(signer))
+	if customerID, ok := other.GetCustomerID(session.SessionKey); !ok || customerID != 7 {
+		t.Errorf("Expected token to validate without shared state, got %d %t", customerID, ok)
+	}
+
+	// 修改 token 之后验证失败
+	tampered := session.SessionKey[:len(session.SessionKey)-2] + "xx"
+	if _, ok := sessionManager.GetCustomerID(tampered); ok {
+		t.Errorf("Expected tampered token to be rejected")
+	}
+
+	refreshed, ok := sessionManager.Refresh(7, session.SessionKey, Fingerprint{})
+	if !ok || refreshed.SessionKey == session.SessionKey {
+		t.Fatalf("Expected refresh to issue a new token")
+	}
+	if _, ok := sessionManager.GetCustomerID(session.SessionKey); ok {
+		t.Errorf("Expected refreshed token to be revoked")
+	}
+
+	if !sessionManager.RevokeKey(refreshed.SessionKey) {
+		t.Errorf("Expected revoke of a valid token to succeed")
+	}
+	if _, err := sessionManager.Authenticate(refreshed.SessionKey, Fingerprint{}); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("Expected revoked token to be rejected, got %v", err)
+	}
+
+	// 撤销客户之后，之前的 token 都失效，之后的可以使用
+	before := sessionManager.GetSession(8)
+	sessionManager.Revoke(8)
+	after := sessionManager.GetSession(8)
+	if _, ok := sessionManager.GetCustomerID(before.SessionKey); ok {
+		t.Errorf("Expected token issued before revoke to be rejected")
+	}
+	if _, ok := sessionManager.GetCustomerID(after.SessionKey); !ok {
+		t.Errorf("Expected token issued after revoke to be accepted")
+	}
+}
+
+func TestTokenKeyRotation(t *testing.T) {
+	sessionManager, signer := newTokenManager(t)
+	old := sessionManager.GetSession(1)
+
+	signer.Rotate("k2", "secret2")
+	current := sessionManager.GetSession(1)
+	for _, session := range []*Session{old, current} {
+		if _, ok := sessionManager.GetCustomerID(session.SessionKey); !ok {
+			t.Errorf("Expected token to be valid after rotation")
+		}
+	}
+
+	if err := signer.Retire("k2"); err == nil {
+		t.Errorf("Expected retiring the active key to fail")
+	}
+	signer.Retire("k1")
+	if _, ok := sessionManager.GetCustomerID(old.SessionKey); ok {
+		t.Errorf("Expected token signed with a retired key to be rejected")
+	}
+	if _, ok := sessionManager.GetCustomerID(current.SessionKey); !ok {
+		t.Errorf("Expected token signed with the active key to stay valid")
+	}
+}
+
+func TestTokenExpiry(t *testing.T) {
+	signer, _ := NewTokenSigner("k1", map[string]string{"k1": "secret1"})
+	sessionManager := NewSessionManager(WithTokenSigner(signer), WithTTL(time.Millisecond))
+	session := sessionManager.GetSession(1)
+	sessionManager.RevokeKey(session.SessionKey)
+	time.Sleep(5 * time.Millisecond)
+
+	if _, err := sessionManager.Authenticate(session.SessionKey, Fingerprint{}); !errors.Is(err, ErrSessionExpired) && !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("Expected expired token to be rejected, got %v", err)
+	}
+	if evicted := sessionManager.Sweep(time.Now()); evicted != 0 {
+		t.Errorf("Expected no sessions evicted in token mode, got %d", evicted)
+	}
+	if pruned := sessionManager.pruneRevoked(time.Now()); pruned != 0 {
+		t.Errorf("Expected Sweep to have pruned the expired denylist entry, got %d left", pruned)
+	}
+	sessionManager.RevokeKey(sessionManager.GetSession(2).SessionKey)
+	time.Sleep(5 * time.Millisecond)
+	if pruned := sessionManager.pruneRevoked(time.Now()); pruned != 1 {
+		t.Errorf("Expected expired denylist entry to be pruned, got %d", pruned)
+	}
+}
+
+func TestSharedDenylist(t *testing.T) {
+	signer, _ := NewTokenSigner("k1", map[string]string{"k1": "secret1"})
+	denylist := NewMemoryDenylist()
+	first := NewSessionManager(WithTokenSigner(signer), WithDenylist(denylist))
+	second := NewSessionManager(WithTokenSigner(signer), WithDenylist(denylist))
+
+	session := first.GetSession(1)
+	first.RevokeKey(session.SessionKey)
+	if _, ok := second.GetCustomerID(session.SessionKey); ok {
+		t.Errorf("Expected a token revoked by one manager to be rejected by the other")
+	}
+}
+
+func TestTokenRevokeOutlivesToken(t *testing.T) {
+	signer, _ := NewTokenSigner("k1", map[string]string{"k1": "secret1"})
+	sessionManager := NewSessionManager(WithTokenSigner(signer), WithTTL(time.Hour), WithMaxLifetime(20*time.Millisecond))
+	session := sessionManager.GetSession(1)
+	if lifetime := session.ExpiryTime.Sub(session.CreatedTime); lifetime != 20*time.Millisecond {
+		t.Fatalf("Expected token capped at the max lifetime, got %v", lifetime)
+	}
+
+	// 撤销记录被清理的时候，之前签发的 token 已经过期，不会复活
+	sessionManager.Revoke(1)
+	time.Sleep(30 * time.Millisecond)
+	if pruned := sessionManager.pruneRevoked(time.Now()); pruned != 1 {
+		t.Errorf("Expected the customer revocation to be pruned, got %d", pruned)
+	}
+	if _, ok := sessionManager.GetCustomerID(session.SessionKey); ok {
+		t.Errorf("Expected revoked token to stay rejected")
+	}
+}
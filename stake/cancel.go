@@ -0,0 +1,67 @@
+package stake
+
+import (
+	"errors"
+	"log"
+)
+
+var ErrNoStake = errors.New("no stake to cancel on this bet offer")
+
+// Cancel withdraws every stake the customer placed on an open offer and returns them.
+// If the customer was on the leaderboard, the best customer from the offer's standings
+// who is not on it yet takes the free place.
+func (sm *StakeMap) Cancel(betOfferID int, custmerID int) ([]Stake, error) {
+	offer, ok := sm.Offer(betOfferID)
+	if !ok {
+		return nil, ErrUnknownOffer
+	}
+	// 写锁挡住并发的下注，排行榜和 standings 保持一致
+	offer.mu.Lock()
+	defer offer.mu.Unlock()
+	if err := offer.checkOpen(); err != nil {
+		return nil, err
+	}
+	cancelled := offer.history.cancel(custmerID)
+	if len(cancelled) == 0 {
+		return nil, ErrNoStake
+	}
+
+	for _, stake := range cancelled {
+		offer.exposure.release(stake.CustomerID, stake.Amount)
+		if day := sm.daily.on(stake.Time); day != nil {
+			day.release(stake.CustomerID, stake.Amount)
+		}
+	}
+	offer.standings.Remove(custmerID)
+	if offer.list.Remove(custmerID) {
+		offer.rerank()
+	}
+	log.Printf("cancelled %d stakes of %d on %d", len(cancelled), custmerID, betOfferID)
+	return cancelled, nil
+}
+
+// rerank brings the leaderboard back to the top customers of the standings after a
+// place opened up on it, by a cancel or by a customer lowering their value. Customers
+// who fell out of the top are taken off and the ones missing are backfilled, in
+// standings order. It must be called with offer.mu held for writing.
+func (offer *Offer) rerank() {
+	top := offer.standings.Top(offer.Config.Depth)
+	inTop := make(map[int]bool, len(top))
+	for _, entry := range top {
+		inTop[entry.ID] = true
+	}
+	onList := make(map[int]bool, len(top))
+	for _, entry := range offer.list.Top(offer.Config.Depth) {
+		// 只有 MergeLatest 会把客户挤出前几名，它的 merger 没有要忘掉的累计值
+		if !inTop[entry.ID] {
+			offer.list.Remove(entry.ID)
+			continue
+		}
+		onList[entry.ID] = true
+	}
+	for _, entry := range top {
+		if !onList[entry.ID] {
+			offer.list.Backfill(entry)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package stake
+
+import (
+	"sync"
+	"time"
+)
+
+// Stake is one accepted stake in a bet offer's history.
+type Stake struct {
+	Seq        int       `json:"seq"` // 在该 bet offer 历史中的下标，分页的 cursor 基于它
+	CustomerID int       `json:"customer_id"`
+	Amount     int       `json:"amount"`
+	Time       time.Time `json:"time"`
+	SessionID  string    `json:"session_id"`          // Session.KeyID()，不保存 session key 本身
+	Cancelled  bool      `json:"cancelled,omitempty"` // 客户撤回了这笔下注
+}
+
+// history is append-only, so a Seq always points at the same stake.
+type history struct {
+	stakes []Stake
+	mu     sync.RWMutex
+}
+
+func (h *history) append(stake Stake) Stake {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	stake.Seq = len(h.stakes)
+	h.stakes = append(h.stakes, stake)
+	return stake
+}
+
+// page returns up to limit stakes starting at cursor and the cursor of the next page.
+func (h *history) page(cursor int, limit int) ([]Stake, int) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if cursor >= len(h.stakes) {
+		return []Stake{}, cursor
+	}
+	end := cursor + limit
+	if end > len(h.stakes) {
+		end = len(h.stakes)
+	}
+	page := make([]Stake, end-cursor)
+	copy(page, h.stakes[cursor:end])
+	return page, end
+}
+
+// cancel marks every active stake of the customer as cancelled and returns them.
+func (h *history) cancel(customerID int) []Stake {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var cancelled []Stake
+	for i := range h.stakes {
+		if h.stakes[i].CustomerID == customerID && !h.stakes[i].Cancelled {
+			h.stakes[i].Cancelled = true
+			cancelled = append(cancelled, h.stakes[i])
+		}
+	}
+	return cancelled
+}
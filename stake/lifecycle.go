@@ -0,0 +1,88 @@
+package stake
+
+import (
+	"errors"
+	"fmt"
+)
+
+// OfferState is where a bet offer is in its lifecycle. Only open offers accept stakes,
+// the leaderboard and history stay readable in every state.
+type OfferState string
+
+const (
+	OfferOpen      OfferState = "open"
+	OfferSuspended OfferState = "suspended" // 暂停下注，可以重新打开
+	OfferClosed    OfferState = "closed"    // 不再接受下注
+	OfferSettled   OfferState = "settled"   // 已经结算
+)
+
+var (
+	ErrOfferNotOpen      = errors.New("bet offer is not open")
+	ErrInvalidTransition = errors.New("invalid bet offer state transition")
+)
+
+// transitions lists the states each state can move to.
+var transitions = map[OfferState][]OfferState{
+	OfferOpen:      {OfferSuspended, OfferClosed},
+	OfferSuspended: {OfferOpen, OfferClosed},
+	OfferClosed:    {OfferSettled},
+}
+
+func ParseOfferState(state string) (OfferState, error) {
+	switch OfferState(state) {
+	case OfferOpen, OfferSuspended, OfferClosed, OfferSettled:
+		return OfferState(state), nil
+	}
+	return "", fmt.Errorf("unknown bet offer state %q", state)
+}
+
+func (state OfferState) canMoveTo(next OfferState) bool {
+	for _, allowed := range transitions[state] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// OfferStatus is what the admin API reports about an offer.
+type OfferStatus struct {
+	ID     int         `json:"id"`
+	State  OfferState  `json:"state"`
+	Config OfferConfig `json:"config"`
+}
+
+func (offer *Offer) State() OfferState {
+	offer.mu.RLock()
+	defer offer.mu.RUnlock()
+	return offer.state
+}
+
+func (offer *Offer) Status() OfferStatus {
+	return OfferStatus{ID: offer.ID, State: offer.State(), Config: offer.Config}
+}
+
+// checkOpen must be called with offer.mu held.
+func (offer *Offer) checkOpen() error {
+	if offer.state != OfferOpen {
+		return fmt.Errorf("%w: bet offer %d is %s", ErrOfferNotOpen, offer.ID, offer.state)
+	}
+	return nil
+}
+
+// Transition moves the offer to state. Stakes being placed finish before the state changes.
+func (sm *StakeMap) Transition(betOfferID int, state OfferState) (OfferStatus, error) {
+	offer, ok := sm.Offer(betOfferID)
+	if !ok {
+		return OfferStatus{}, ErrUnknownOffer
+	}
+	offer.mu.Lock()
+	if !offer.state.canMoveTo(state) {
+		current := offer.state
+		offer.mu.Unlock()
+		return OfferStatus{}, fmt.Errorf("%w: %s to %s", ErrInvalidTransition, current, state)
+	}
+	offer.state = state
+	offer.mu.Unlock()
+	return offer.Status(), nil
+}
@@ -0,0 +1,119 @@
+package stake
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// LimitReason names the limit a rejected stake broke.
+type LimitReason string
+
+const (
+	LimitMinStake      LimitReason = "min_stake"
+	LimitMaxStake      LimitReason = "max_stake"
+	LimitOfferExposure LimitReason = "offer_exposure" // 客户在一个 bet offer 上的累计下注
+	LimitDailyExposure LimitReason = "daily_exposure" // 客户当天在所有 bet offer 上的累计下注
+)
+
+// LimitError is returned by Place when a stake breaks one of the limits.
+type LimitError struct {
+	Reason LimitReason
+	Limit  int // 违反的限额
+	Amount int // 被拒绝的下注金额
+}
+
+func (e *LimitError) Error() string {
+	switch e.Reason {
+	case LimitMinStake:
+		return fmt.Sprintf("stake %d is below the minimum of %d", e.Amount, e.Limit)
+	case LimitMaxStake:
+		return fmt.Sprintf("stake %d is above the maximum of %d", e.Amount, e.Limit)
+	case LimitOfferExposure:
+		return fmt.Sprintf("stake %d would exceed the limit of %d on this bet offer", e.Amount, e.Limit)
+	}
+	return fmt.Sprintf("stake %d would exceed the daily limit of %d", e.Amount, e.Limit)
+}
+
+// checkAmount applies the offer's min and max stake. Stakes below 1 are always rejected.
+func (cfg OfferConfig) checkAmount(amount int) error {
+	minimum := max(cfg.MinStake, 1)
+	if amount < minimum {
+		return &LimitError{Reason: LimitMinStake, Limit: minimum, Amount: amount}
+	}
+	if cfg.MaxStake > 0 && amount > cfg.MaxStake {
+		return &LimitError{Reason: LimitMaxStake, Limit: cfg.MaxStake, Amount: amount}
+	}
+	return nil
+}
+
+// exposure adds up what each customer has staked, rejecting stakes that would pass limit.
+type exposure struct {
+	totals map[int]int
+	mu     sync.Mutex
+}
+
+// reserve adds amount to the customer's total; a limit of 0 means no limit.
+func (e *exposure) reserve(customerID int, amount int, limit int, reason LimitReason) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	current := e.totals[customerID]
+	if limit > 0 && amount > limit-current { // 写成减法，避免接近 MaxInt 时溢出
+		return &LimitError{Reason: reason, Limit: limit, Amount: amount}
+	}
+	if e.totals == nil {
+		e.totals = make(map[int]int)
+	}
+	e.totals[customerID] = current + amount
+	return nil
+}
+
+func (e *exposure) release(customerID int, amount int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.totals[customerID] <= amount {
+		delete(e.totals, customerID)
+		return
+	}
+	e.totals[customerID] -= amount
+}
+
+// dailyExposure is an exposure that starts over every UTC day.
+type dailyExposure struct {
+	day     string
+	current *exposure
+	mu      sync.Mutex
+}
+
+// on returns the exposure of the day at falls on, or nil if that day is already over.
+func (d *dailyExposure) on(at time.Time) *exposure {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	day := at.UTC().Format(time.DateOnly)
+	if day > d.day {
+		d.day = day
+		d.current = &exposure{}
+	}
+	if day != d.day {
+		return nil
+	}
+	return d.current
+}
+
+// reserve checks the stake against the offer's limits and the daily limit, and counts it
+// towards the customer's exposure if it passes.
+func (sm *StakeMap) reserve(offer *Offer, stake Stake) error {
+	if err := offer.Config.checkAmount(stake.Amount); err != nil {
+		return err
+	}
+	if err := offer.exposure.reserve(stake.CustomerID, stake.Amount, offer.Config.MaxExposure, LimitOfferExposure); err != nil {
+		return err
+	}
+	if today := sm.daily.on(stake.Time); today != nil {
+		if err := today.reserve(stake.CustomerID, stake.Amount, sm.DailyLimit, LimitDailyExposure); err != nil {
+			offer.exposure.release(stake.CustomerID, stake.Amount)
+			return err
+		}
+	}
+	return nil
+}
@@ -5,13 +5,16 @@ import (
 	//"main/types"
 	"log"
 	"sync"
+	"time"
 )
 
 type Node struct {
-	ID    int
-	Value int
-	Prev  *Node
-	Next  *Node
+	ID     int
+	Value  int
+	Seq    int64     // 插入顺序，金额相同时按 TieBreak 排序
+	Placed time.Time // 下注时间
+	Prev   *Node
+	Next   *Node
 }
 
 type DoublyLinkedList struct {
@@ -20,25 +23,44 @@ type DoublyLinkedList struct {
 	Size    int
 	maxSize int
 	nodeMap map[int]*Node // 用于快速查找节点的 map
-	mu      sync.RWMutex  // 添加读写锁
+	merge   merger
+	ties    TieBreak
+	seq     sequence
+	mu      sync.RWMutex // 添加读写锁
 }
 
 func NewDoublyLinkedList(maxSize int) *DoublyLinkedList {
+	return NewDoublyLinkedListWithPolicy(maxSize, MergeMax, TieFirstCome)
+}
+
+func NewDoublyLinkedListWithPolicy(maxSize int, policy MergePolicy, ties TieBreak) *DoublyLinkedList {
 	return &DoublyLinkedList{
 		maxSize: maxSize,
 		nodeMap: make(map[int]*Node),
+		merge:   newMerger(policy),
+		ties:    ties,
 	}
 }
 func (list *DoublyLinkedList) Insert(id int, value int) {
+	list.InsertAt(id, value, time.Now())
+}
+
+// InsertAt is Insert for a stake placed at the given time.
+func (list *DoublyLinkedList) InsertAt(id int, value int, placed time.Time) {
 	list.mu.Lock() // 加写锁
 	defer list.mu.Unlock()
-	newNode := &Node{ID: id, Value: value}
 	// 查找是否已经存在相同的ID
 	existingNode := list.findNodeById(id)
+	current := 0
+	if existingNode != nil {
+		current = existingNode.Value
+	}
+	merged, changed := list.merge.next(id, current, existingNode != nil, value)
+	newNode := &Node{ID: id, Value: merged, Seq: list.seq.next(), Placed: placed}
 	log.Printf("%d=%d ,add at link", newNode.ID, newNode.Value)
 
 	if existingNode != nil {
-		if value > existingNode.Value { // 如果新值更大，则更新
+		if changed { // 合并后的值变了才更新
 			list.removeNode(existingNode) // 删除旧节点
 			list.insertNewNode(newNode)   //  插入新节点
 		}
@@ -50,21 +72,26 @@ func (list *DoublyLinkedList) Insert(id int, value int) {
 	}
 }
 
+// before reports whether a ranks ahead of b.
+func (list *DoublyLinkedList) before(a *Node, b *Node) bool {
+	return list.ties.ranksBefore(a.Value, a.Seq, b.Value, b.Seq)
+}
+
 func (list *DoublyLinkedList) insertNewNode(newNode *Node) {
-	if list.Size == list.maxSize && newNode.Value <= list.Tail.Value { // 如果列表满了，并且新节点比尾部的小
+	if list.Size == list.maxSize && !list.before(newNode, list.Tail) { // 如果列表满了，并且新节点排在尾部后面
 		return // 直接返回
 	}
 
 	if list.Head == nil { // 链表为空
 		list.Head = newNode
 		list.Tail = newNode
-	} else if newNode.Value >= list.Head.Value { // 如果新节点比头节点大，则插入到头节点
+	} else if list.before(newNode, list.Head) { // 如果新节点排在头节点前面，则插入到头节点
 		newNode.Next = list.Head
 		list.Head.Prev = newNode
 		list.Head = newNode
-	} else { // 如果新节点比头节点小，则需要遍历插入
+	} else { // 否则需要遍历插入
 		current := list.Head
-		for current.Next != nil && newNode.Value < current.Next.Value { // 寻找插入的位置
+		for current.Next != nil && list.before(current.Next, newNode) { // 寻找插入的位置
 			current = current.Next
 		}
 
@@ -125,6 +152,30 @@ func (list *DoublyLinkedList) removeNode(node *Node) {
 	delete(list.nodeMap, node.ID) // 从 map 中删除
 	list.Size--
 }
+
+// Remove takes the customer off the list and reports whether they were on it.
+func (list *DoublyLinkedList) Remove(id int) bool {
+	list.mu.Lock()
+	defer list.mu.Unlock()
+	list.merge.forget(id)
+	node := list.findNodeById(id)
+	if node == nil {
+		return false
+	}
+	list.removeNode(node)
+	return true
+}
+
+// Backfill puts an already merged entry on the list, below everyone it ties with.
+func (list *DoublyLinkedList) Backfill(entry Entry) {
+	list.mu.Lock()
+	defer list.mu.Unlock()
+	if list.findNodeById(entry.ID) != nil {
+		return
+	}
+	list.insertNewNode(&Node{ID: entry.ID, Value: entry.Value, Seq: list.seq.trailingFor(list.ties), Placed: entry.Placed})
+}
+
 func (list *DoublyLinkedList) findNodeById(id int) *Node {
 	node, ok := list.nodeMap[id]
 	if ok {
@@ -147,3 +198,29 @@ func (list *DoublyLinkedList) Getlinklist(n int) []string {
 	return result
 
 }
+
+// Top returns up to n entries from the top, with their placement times.
+func (list *DoublyLinkedList) Top(n int) []Entry {
+	list.mu.RLock()
+	defer list.mu.RUnlock()
+	result := make([]Entry, 0, min(n, list.Size))
+	for current := list.Head; current != nil && len(result) < n; current = current.Next {
+		result = append(result, Entry{ID: current.ID, Value: current.Value, Seq: current.Seq, Placed: current.Placed})
+	}
+	return result
+}
+
+// Rank returns the customer's 1-based position and value, false if they are not on the list.
+func (list *DoublyLinkedList) Rank(id int) (int, int, bool) {
+	list.mu.RLock()
+	defer list.mu.RUnlock()
+	node := list.findNodeById(id)
+	if node == nil {
+		return 0, 0, false
+	}
+	rank := 1
+	for current := list.Head; current != node; current = current.Next {
+		rank++
+	}
+	return rank, node.Value, true
+}
@@ -256,6 +256,111 @@ func TestDoublyLinkedList(t *testing.T) {
 
 }
 
+func TestMergePolicy(t *testing.T) {
+	cases := []struct {
+		policy   MergePolicy
+		expected []string
+	}{
+		{MergeMax, []string{"2=300", "1=100"}},
+		{MergeLatest, []string{"1=100", "2=50"}},
+		{MergeSum, []string{"2=350", "1=300"}},
+		{MergeCount, []string{"1=3", "2=2"}},
+	}
+	for _, c := range cases {
+		lists := map[string]Leaderboard{
+			"linked list": NewDoublyLinkedListWithPolicy(5, c.policy, TieFirstCome),
+			"skip list":   NewSkipListWithPolicy(5, c.policy, TieFirstCome),
+		}
+		for name, list := range lists {
+			list.Insert(1, 100)
+			list.Insert(2, 300)
+			list.Insert(1, 100)
+			list.Insert(2, 50)
+			list.Insert(1, 100)
+			actual := list.Getlinklist(5)
+			if !equal(actual, c.expected) {
+				t.Errorf("%s %s: Expected %v, Got %v", c.policy, name, c.expected, actual)
+			}
+		}
+	}
+
+	// latest 下客户把下注改小之后，之前被挤出去的客户重新排上来
+	for _, depth := range []int{1, 20, 100} {
+		stakeMap := NewStakeMapWithDefaults(OfferConfig{Depth: depth, Merge: MergeLatest})
+		for id := 1; id <= depth+1; id++ {
+			stakeMap.Insert(id, 1, 1000-id)
+		}
+		stakeMap.Insert(1, 1, 10)
+		top, _ := stakeMap.TopEntries(1, 0)
+		if len(top) != depth || top[depth-1].ID != depth+1 {
+			t.Errorf("latest depth %d: Expected customer %d backfilled last, got %v", depth, depth+1, top)
+		}
+		if _, _, ok := stakeMap.Rank(1, 1); ok {
+			t.Errorf("latest depth %d: Expected the lowered customer off the leaderboard", depth)
+		}
+	}
+	stakeMap := NewStakeMapWithDefaults(OfferConfig{Depth: 2, Merge: MergeLatest})
+	stakeMap.Insert(1, 1, 100)
+	stakeMap.Insert(2, 1, 50)
+	stakeMap.Insert(3, 1, 30)
+	stakeMap.Insert(1, 1, 40)
+	if actual, _ := stakeMap.GetTop(1, 0); !equal(actual, []string{"2=50", "1=40"}) {
+		t.Errorf("latest: Expected the lowered customer to keep a place they still earn, got %v", actual)
+	}
+}
+
+func TestMergePolicyKeepsTotalsOffList(t *testing.T) {
+	// 被挤出排行榜的客户，再次下注时累计值不会丢
+	for _, list := range []Leaderboard{NewDoublyLinkedListWithPolicy(1, MergeSum, TieFirstCome), NewSkipListWithPolicy(1, MergeSum, TieFirstCome)} {
+		list.Insert(1, 10)
+		list.Insert(2, 15)
+		list.Insert(1, 10)
+		expected := []string{"1=20"}
+		if actual := list.Getlinklist(1); !equal(actual, expected) {
+			t.Errorf("%T: Expected %v, Got %v", list, expected, actual)
+		}
+	}
+	if _, err := ParseMergePolicy("avg"); err == nil {
+		t.Errorf("Expected unknown merge policy to be rejected")
+	}
+}
+
+func TestTieBreak(t *testing.T) {
+	cases := []struct {
+		ties     TieBreak
+		expected []string
+	}{
+		{TieFirstCome, []string{"4=20", "1=10", "2=10", "3=10"}},
+		{TieLastCome, []string{"4=20", "5=10", "3=10", "2=10"}},
+	}
+	for _, c := range cases {
+		for _, list := range []Leaderboard{NewDoublyLinkedListWithPolicy(4, MergeMax, c.ties), NewSkipListWithPolicy(4, MergeMax, c.ties)} {
+			// 头部和中间的相同金额顺序一致
+			list.Insert(1, 10)
+			list.Insert(2, 10)
+			list.Insert(4, 20)
+			list.Insert(3, 10)
+			// 满了以后，相同金额只有后到优先时才能挤掉最后一名
+			list.Insert(5, 10)
+			if actual := list.Getlinklist(4); !equal(actual, c.expected) {
+				t.Errorf("%s %T: Expected %v, Got %v", c.ties, list, c.expected, actual)
+			}
+		}
+	}
+}
+
+func TestTopEntries(t *testing.T) {
+	placed := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	for _, list := range []Leaderboard{NewDoublyLinkedList(5), NewSkipList(5)} {
+		list.InsertAt(1, 10, placed)
+		list.InsertAt(2, 10, placed.Add(time.Second))
+		entries := list.Top(5)
+		if len(entries) != 2 || entries[0].ID != 1 || !entries[0].Placed.Equal(placed) || entries[0].Seq >= entries[1].Seq {
+			t.Errorf("%T: unexpected entries %+v", list, entries)
+		}
+	}
+}
+
 // Helper function to compare string slices
 func equal(a, b []string) bool {
 	if len(a) != len(b) {
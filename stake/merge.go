@@ -0,0 +1,73 @@
+package stake
+
+import "fmt"
+
+// MergePolicy decides how a customer's stakes on one offer combine into their leaderboard value.
+type MergePolicy string
+
+const (
+	MergeMax    MergePolicy = "max"    // 保留最大的一次下注
+	MergeLatest MergePolicy = "latest" // 保留最后一次下注
+	MergeSum    MergePolicy = "sum"    // 累计下注金额
+	MergeCount  MergePolicy = "count"  // 下注次数
+)
+
+func ParseMergePolicy(policy string) (MergePolicy, error) {
+	switch MergePolicy(policy) {
+	case "", MergeMax:
+		return MergeMax, nil
+	case MergeLatest, MergeSum, MergeCount:
+		return MergePolicy(policy), nil
+	}
+	return MergeMax, fmt.Errorf("unknown stake merge policy %q", policy)
+}
+
+// merge returns the customer's new value after staking value, and false if it does not change.
+// seen is false for the customer's first stake.
+func (p MergePolicy) merge(old int, seen bool, value int) (int, bool) {
+	switch {
+	case p == MergeCount:
+		return old + 1, true
+	case !seen:
+		return value, true
+	case p == MergeLatest:
+		return value, value != old
+	case p == MergeSum:
+		return old + value, value != 0
+	}
+	return value, value > old
+}
+
+// merger keeps what a leaderboard needs to apply its policy. Cumulative policies remember
+// every customer's total, since a customer pushed off the list can still climb back.
+type merger struct {
+	policy MergePolicy
+	totals map[int]int
+}
+
+func newMerger(policy MergePolicy) merger {
+	m := merger{policy: policy}
+	if policy == MergeSum || policy == MergeCount {
+		m.totals = make(map[int]int)
+	}
+	return m
+}
+
+// forget drops what the merger remembers about a customer whose stakes were cancelled.
+func (m merger) forget(id int) {
+	if m.totals != nil {
+		delete(m.totals, id)
+	}
+}
+
+// next returns the customer's new value; current is their value on the list, if onList.
+func (m merger) next(id int, current int, onList bool, value int) (int, bool) {
+	if m.totals != nil {
+		current, onList = m.totals[id]
+	}
+	merged, changed := m.policy.merge(current, onList, value)
+	if m.totals != nil {
+		m.totals[id] = merged
+	}
+	return merged, changed
+}
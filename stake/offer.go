@@ -0,0 +1,127 @@
+package stake
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultDepth = 20
+	// 超过这个深度时用 SkipList，链表的线性插入只适合很短的排行榜
+	linkedListMaxDepth = 64
+)
+
+var (
+	ErrOfferExists  = errors.New("bet offer already exists")
+	ErrUnknownOffer = errors.New("unknown bet offer")
+)
+
+// OfferConfig is fixed when a bet offer is created.
+type OfferConfig struct {
+	Depth int         `json:"depth"` // 排行榜保留多少名
+	Merge MergePolicy `json:"merge"` // 同一个客户多次下注如何合并，默认 max
+	Ties  TieBreak    `json:"ties"`  // 金额相同时谁排在前面，默认先到的
+	// 下注限额，0 表示不限制；低于 1 的下注总是被拒绝
+	MinStake    int `json:"min_stake"`
+	MaxStake    int `json:"max_stake"`
+	MaxExposure int `json:"max_exposure"` // 每个客户在这个 bet offer 上的累计下注上限
+}
+
+func (cfg OfferConfig) Validate() error {
+	if cfg.Depth <= 0 {
+		return fmt.Errorf("leaderboard depth must be positive, got %d", cfg.Depth)
+	}
+	if cfg.MinStake < 0 || cfg.MaxStake < 0 || cfg.MaxExposure < 0 {
+		return fmt.Errorf("stake limits must not be negative")
+	}
+	if cfg.MaxStake > 0 && cfg.MinStake > cfg.MaxStake {
+		return fmt.Errorf("minimum stake %d is above the maximum %d", cfg.MinStake, cfg.MaxStake)
+	}
+	if _, err := ParseMergePolicy(string(cfg.Merge)); err != nil {
+		return err
+	}
+	_, err := ParseTieBreak(string(cfg.Ties))
+	return err
+}
+
+// Leaderboard keeps the highest stake of each customer, ordered from the top.
+type Leaderboard interface {
+	Insert(id int, value int)
+	InsertAt(id int, value int, placed time.Time)
+	Getlinklist(n int) []string
+	Top(n int) []Entry
+	// Rank returns the customer's 1-based position and value.
+	Rank(id int) (int, int, bool)
+	// Remove takes the customer off, forgetting their merged value, and reports whether they were on it.
+	Remove(id int) bool
+	// Backfill puts an already merged entry on the list, below everyone it ties with.
+	Backfill(entry Entry)
+}
+
+func newLeaderboard(cfg OfferConfig) Leaderboard {
+	policy, _ := ParseMergePolicy(string(cfg.Merge))
+	ties, _ := ParseTieBreak(string(cfg.Ties))
+	if cfg.Depth > linkedListMaxDepth {
+		return NewSkipListWithPolicy(cfg.Depth, policy, ties)
+	}
+	return NewDoublyLinkedListWithPolicy(cfg.Depth, policy, ties)
+}
+
+// newStandings returns a list of every customer on the offer, merged like the leaderboard.
+func newStandings(cfg OfferConfig) *SkipList {
+	policy, _ := ParseMergePolicy(string(cfg.Merge))
+	ties, _ := ParseTieBreak(string(cfg.Ties))
+	return NewSkipListWithPolicy(0, policy, ties)
+}
+
+// Offer is one bet offer and its leaderboard.
+type Offer struct {
+	ID        int
+	Config    OfferConfig
+	list      Leaderboard
+	history   history   // 所有接受的下注，不受排行榜深度限制
+	standings *SkipList // 每个客户合并后的值，不限深度，撤回时从这里补位
+	state     OfferState
+	exposure  exposure     // 每个客户的累计下注
+	mu        sync.RWMutex // 下注时读锁，改变状态时写锁
+}
+
+func newOffer(betOfferID int, cfg OfferConfig) *Offer {
+	return &Offer{
+		ID:        betOfferID,
+		Config:    cfg,
+		list:      newLeaderboard(cfg),
+		standings: newStandings(cfg),
+		state:     OfferOpen,
+	}
+}
+
+// limit caps a requested number of leaderboard entries at the offer's depth; 0 means all of it.
+func (offer *Offer) limit(limit int) int {
+	if limit <= 0 || limit > offer.Config.Depth {
+		return offer.Config.Depth
+	}
+	return limit
+}
+
+// CreateOffer registers a bet offer with its own configuration before any stake is placed.
+func (sm *StakeMap) CreateOffer(betOfferID int, cfg OfferConfig) (*Offer, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	offer, loaded := sm.StakeMap.LoadOrStore(betOfferID, newOffer(betOfferID, cfg))
+	if loaded {
+		return nil, ErrOfferExists
+	}
+	return offer.(*Offer), nil
+}
+
+func (sm *StakeMap) Offer(betOfferID int) (*Offer, bool) {
+	offer, ok := sm.StakeMap.Load(betOfferID)
+	if !ok {
+		return nil, false
+	}
+	return offer.(*Offer), true
+}
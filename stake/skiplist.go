@@ -0,0 +1,248 @@
+package stake
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	skipListMaxLevel = 32
+	skipListP        = 0.25
+)
+
+type skipNode struct {
+	ID     int
+	Value  int
+	seq    int64 // 插入顺序，金额相同时按 TieBreak 排序
+	placed time.Time
+	next   []*skipNode
+	span   []int // span[i] 是 next[i] 跳过的节点数，用于计算排名
+}
+
+// SkipList is an indexable skip list with the same semantics as DoublyLinkedList,
+// but O(log n) insert, update and rank lookup. A maxSize of 0 keeps every customer.
+type SkipList struct {
+	head    *skipNode
+	level   int
+	Size    int
+	maxSize int
+	seq     sequence
+	nodeMap map[int]*skipNode
+	merge   merger
+	ties    TieBreak
+	rand    *rand.Rand
+	mu      sync.RWMutex
+}
+
+func NewSkipList(maxSize int) *SkipList {
+	return NewSkipListWithPolicy(maxSize, MergeMax, TieFirstCome)
+}
+
+func NewSkipListWithPolicy(maxSize int, policy MergePolicy, ties TieBreak) *SkipList {
+	return &SkipList{
+		head:    &skipNode{next: make([]*skipNode, skipListMaxLevel), span: make([]int, skipListMaxLevel)},
+		level:   1,
+		maxSize: maxSize,
+		nodeMap: make(map[int]*skipNode),
+		merge:   newMerger(policy),
+		ties:    ties,
+		rand:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// before reports whether a ranks ahead of b.
+func (list *SkipList) before(a *skipNode, b *skipNode) bool {
+	return list.ties.ranksBefore(a.Value, a.seq, b.Value, b.seq)
+}
+
+func (list *SkipList) Insert(id int, value int) {
+	list.InsertAt(id, value, time.Now())
+}
+
+// InsertAt is Insert for a stake placed at the given time.
+func (list *SkipList) InsertAt(id int, value int, placed time.Time) {
+	list.mu.Lock()
+	defer list.mu.Unlock()
+
+	existing, ok := list.nodeMap[id]
+	current := 0
+	if ok {
+		current = existing.Value
+	}
+	value, changed := list.merge.next(id, current, ok, value)
+	if ok {
+		if !changed {
+			return
+		}
+		list.remove(existing)
+	}
+	node := &skipNode{ID: id, Value: value, seq: list.seq.next(), placed: placed}
+	if list.maxSize > 0 && list.Size == list.maxSize && !list.before(node, list.last()) { // 满了并且排在最后一名后面
+		return
+	}
+	list.insert(node)
+	if list.maxSize > 0 && list.Size > list.maxSize {
+		list.remove(list.last())
+	}
+}
+
+// Remove takes the customer off the list and reports whether they were on it.
+func (list *SkipList) Remove(id int) bool {
+	list.mu.Lock()
+	defer list.mu.Unlock()
+	list.merge.forget(id)
+	node, ok := list.nodeMap[id]
+	if !ok {
+		return false
+	}
+	list.remove(node)
+	return true
+}
+
+// Backfill puts an already merged entry on the list, below everyone it ties with.
+func (list *SkipList) Backfill(entry Entry) {
+	list.mu.Lock()
+	defer list.mu.Unlock()
+	if _, ok := list.nodeMap[entry.ID]; ok {
+		return
+	}
+	node := &skipNode{ID: entry.ID, Value: entry.Value, seq: list.seq.trailingFor(list.ties), placed: entry.Placed}
+	if list.maxSize > 0 && list.Size == list.maxSize && !list.before(node, list.last()) {
+		return
+	}
+	list.insert(node)
+	if list.maxSize > 0 && list.Size > list.maxSize {
+		list.remove(list.last())
+	}
+}
+
+func (list *SkipList) randomLevel() int {
+	level := 1
+	for level < skipListMaxLevel && list.rand.Float64() < skipListP {
+		level++
+	}
+	return level
+}
+
+func (list *SkipList) insert(node *skipNode) {
+	var update [skipListMaxLevel]*skipNode
+	var rank [skipListMaxLevel]int
+	current := list.head
+	for i := list.level - 1; i >= 0; i-- {
+		if i < list.level-1 {
+			rank[i] = rank[i+1]
+		}
+		for current.next[i] != nil && list.before(current.next[i], node) {
+			rank[i] += current.span[i]
+			current = current.next[i]
+		}
+		update[i] = current
+	}
+
+	level := list.randomLevel()
+	if level > list.level {
+		for i := list.level; i < level; i++ {
+			update[i] = list.head
+			list.head.span[i] = list.Size
+		}
+		list.level = level
+	}
+
+	node.next = make([]*skipNode, level)
+	node.span = make([]int, level)
+	for i := 0; i < level; i++ {
+		node.next[i] = update[i].next[i]
+		update[i].next[i] = node
+		node.span[i] = update[i].span[i] - (rank[0] - rank[i])
+		update[i].span[i] = rank[0] - rank[i] + 1
+	}
+	for i := level; i < list.level; i++ { // 更高层跨过了新节点
+		update[i].span[i]++
+	}
+	list.nodeMap[node.ID] = node
+	list.Size++
+}
+
+func (list *SkipList) remove(node *skipNode) {
+	var update [skipListMaxLevel]*skipNode
+	current := list.head
+	for i := list.level - 1; i >= 0; i-- {
+		for current.next[i] != nil && list.before(current.next[i], node) {
+			current = current.next[i]
+		}
+		update[i] = current
+	}
+
+	for i := 0; i < list.level; i++ {
+		if update[i].next[i] == node {
+			update[i].span[i] += node.span[i] - 1
+			update[i].next[i] = node.next[i]
+		} else {
+			update[i].span[i]--
+		}
+	}
+	for list.level > 1 && list.head.next[list.level-1] == nil {
+		list.level--
+	}
+	delete(list.nodeMap, node.ID)
+	list.Size--
+}
+
+// last returns the lowest ranked node, or nil when the list is empty.
+func (list *SkipList) last() *skipNode {
+	current := list.head
+	for i := list.level - 1; i >= 0; i-- {
+		for current.next[i] != nil {
+			current = current.next[i]
+		}
+	}
+	if current == list.head {
+		return nil
+	}
+	return current
+}
+
+func (list *SkipList) Getlinklist(n int) []string {
+	list.mu.RLock()
+	defer list.mu.RUnlock()
+	var result []string
+	for current := list.head.next[0]; current != nil && len(result) < n; current = current.next[0] {
+		result = append(result, fmt.Sprintf("%d=%d", current.ID, current.Value))
+	}
+	return result
+}
+
+// Top returns up to n entries from the top, with their placement times.
+func (list *SkipList) Top(n int) []Entry {
+	list.mu.RLock()
+	defer list.mu.RUnlock()
+	result := make([]Entry, 0, min(n, list.Size))
+	for current := list.head.next[0]; current != nil && len(result) < n; current = current.next[0] {
+		result = append(result, Entry{ID: current.ID, Value: current.Value, Seq: current.seq, Placed: current.placed})
+	}
+	return result
+}
+
+// Rank returns the customer's 1-based position and value, false if they are not on the list.
+func (list *SkipList) Rank(id int) (int, int, bool) {
+	list.mu.RLock()
+	defer list.mu.RUnlock()
+	node, ok := list.nodeMap[id]
+	if !ok {
+		return 0, 0, false
+	}
+	rank := 0
+	current := list.head
+	for i := list.level - 1; i >= 0; i-- {
+		for current.next[i] != nil && !list.before(node, current.next[i]) {
+			rank += current.span[i]
+			current = current.next[i]
+		}
+		if current == node {
+			return rank, node.Value, true
+		}
+	}
+	return 0, 0, false
+}
@@ -0,0 +1,85 @@
+package stake
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"testing"
+)
+
+func TestSkipListMatchesLinkedList(t *testing.T) {
+	for _, depth := range []int{1, 5, 20} {
+		list := NewDoublyLinkedList(depth)
+		skip := NewSkipList(depth)
+		for i := 0; i < 2000; i++ {
+			id := rand.Intn(50)
+			value := rand.Intn(200)
+			list.Insert(id, value)
+			skip.Insert(id, value)
+			if expected, actual := list.Getlinklist(depth), skip.Getlinklist(depth); !equal(actual, expected) {
+				t.Fatalf("depth %d: after %d=%d expected %v, got %v", depth, id, value, expected, actual)
+			}
+		}
+		if skip.Size != len(skip.nodeMap) || skip.Size != list.Size {
+			t.Errorf("depth %d: expected size %d, got %d (map %d)", depth, list.Size, skip.Size, len(skip.nodeMap))
+		}
+	}
+}
+
+func TestSkipListRank(t *testing.T) {
+	skip := NewSkipList(0)
+	for id := 1; id <= 1000; id++ {
+		skip.Insert(id, id)
+	}
+	for _, id := range []int{1, 500, 1000} {
+		if rank, value, ok := skip.Rank(id); !ok || rank != 1001-id || value != id {
+			t.Errorf("Expected customer %d at rank %d, got %d %d %t", id, 1001-id, rank, value, ok)
+		}
+	}
+	// 更新后排名随之改变
+	skip.Insert(1, 5000)
+	if rank, _, _ := skip.Rank(1); rank != 1 {
+		t.Errorf("Expected updated customer at rank 1, got %d", rank)
+	}
+	if rank, _, _ := skip.Rank(1000); rank != 2 {
+		t.Errorf("Expected previous leader at rank 2, got %d", rank)
+	}
+	if _, _, ok := skip.Rank(2000); ok {
+		t.Errorf("Expected unknown customer to have no rank")
+	}
+
+	list := NewDoublyLinkedList(3)
+	list.Insert(1, 10)
+	list.Insert(2, 30)
+	list.Insert(3, 20)
+	if rank, value, ok := list.Rank(3); !ok || rank != 2 || value != 20 {
+		t.Errorf("Expected linked list rank 2, got %d %d %t", rank, value, ok)
+	}
+}
+
+func benchmarkLeaderboard(b *testing.B, newList func(depth int) Leaderboard) {
+	output := log.Writer()
+	log.SetOutput(io.Discard) // DoublyLinkedList 每次插入都写日志
+	defer log.SetOutput(output)
+	for _, depth := range []int{20, 1000, 10000} {
+		b.Run(fmt.Sprint(depth), func(b *testing.B) {
+			list := newList(depth)
+			for i := 0; i < depth; i++ {
+				list.Insert(i, rand.Intn(1000000))
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				list.Insert(rand.Intn(depth*2), rand.Intn(1000000))
+			}
+		})
+	}
+}
+
+func BenchmarkLinkedListInsert(b *testing.B) {
+	benchmarkLeaderboard(b, func(depth int) Leaderboard { return NewDoublyLinkedList(depth) })
+}
+
+func BenchmarkSkipListInsert(b *testing.B) {
+	benchmarkLeaderboard(b, func(depth int) Leaderboard { return NewSkipList(depth) })
+}
@@ -3,48 +3,132 @@ package stake
 import (
 	"log"
 	"sync"
+	"time"
 )
 
 type StakeMap struct {
-	StakeMap sync.Map // betOfferId -> stakeMap
-
+	StakeMap   sync.Map    // betOfferId -> *Offer
+	Defaults   OfferConfig // 没有提前创建的 bet offer 使用的配置
+	AutoCreate bool        // 第一次下注时自动创建 bet offer，关闭后只能通过 CreateOffer 创建
+	DailyLimit int         // 每个客户每天在所有 bet offer 上的累计下注上限，0 表示不限制
+	daily      dailyExposure
 }
 
 func NewstakeMap() *StakeMap {
+	return NewStakeMapWithDefaults(OfferConfig{Depth: DefaultDepth})
+}
+
+func NewStakeMapWithDefaults(defaults OfferConfig) *StakeMap {
+	if defaults.Depth <= 0 {
+		defaults.Depth = DefaultDepth
+	}
+	defaults.Merge, _ = ParseMergePolicy(string(defaults.Merge)) // 无效的策略按 max 处理
+	defaults.Ties, _ = ParseTieBreak(string(defaults.Ties))
 	return &StakeMap{
-		StakeMap: sync.Map{},
+		StakeMap:   sync.Map{},
+		Defaults:   defaults,
+		AutoCreate: true,
 	}
 }
-func (sm *StakeMap) Insert(custmerID int, betOfferID int, value int, maxHighStakes int) {
 
-	oldlist, ok := sm.StakeMap.Load(betOfferID) // 使用Load获取，如果不存在则创建
+func (sm *StakeMap) Insert(custmerID int, betOfferID int, value int) error {
+	_, err := sm.Place(betOfferID, Stake{CustomerID: custmerID, Amount: value})
+	return err
+}
+
+// Place records the stake in the offer's history and updates the leaderboard.
+// The returned stake has its Seq and Time filled in. It fails with ErrOfferNotOpen
+// unless the offer is open, with ErrUnknownOffer when AutoCreate is off, and with a
+// *LimitError when the stake breaks a limit.
+func (sm *StakeMap) Place(betOfferID int, stake Stake) (Stake, error) {
 	log.Printf("in stake run post func")
+	offer, ok := sm.Offer(betOfferID)
 	if !ok {
-		list := NewDoublyLinkedList(maxHighStakes)
-		list.Insert(custmerID, value)
-		log.Printf("add in linklist%d ", custmerID)
-		sm.StakeMap.Store(betOfferID, list) // 使用 Store 添加数据
-		// betMap = list
-	} else {
-		olist := oldlist.(*DoublyLinkedList) // 断言类型
-		olist.Insert(custmerID, value)
-		sm.StakeMap.Store(betOfferID, olist) // 使用 Store 添加数据
+		if !sm.AutoCreate {
+			return Stake{}, ErrUnknownOffer
+		}
+		// 第一次下注时使用默认配置创建，LoadOrStore 保证并发时只创建一个
+		created, _ := sm.StakeMap.LoadOrStore(betOfferID, newOffer(betOfferID, sm.Defaults))
+		offer = created.(*Offer)
+	}
+	offer.mu.RLock()
+	stake, lowered, err := sm.place(offer, stake)
+	offer.mu.RUnlock()
+	if lowered {
+		// 客户的值变小了，排行榜下面空出来的位置要从 standings 补上，需要写锁
+		offer.mu.Lock()
+		offer.rerank()
+		offer.mu.Unlock()
+	}
+	return stake, err
+}
 
+// place does the work of Place with offer.mu held for reading. It reports whether the
+// stake lowered the customer's merged value, which only MergeLatest allows.
+func (sm *StakeMap) place(offer *Offer, stake Stake) (Stake, bool, error) {
+	if err := offer.checkOpen(); err != nil {
+		return Stake{}, false, err
+	}
+	if stake.Time.IsZero() {
+		stake.Time = time.Now()
+	}
+	if err := sm.reserve(offer, stake); err != nil {
+		return Stake{}, false, err
+	}
+	lowered := false
+	if offer.Config.Merge == MergeLatest {
+		_, previous, seen := offer.standings.Rank(stake.CustomerID)
+		lowered = seen && stake.Amount < previous
 	}
+	stake = offer.history.append(stake)
+	offer.list.InsertAt(stake.CustomerID, stake.Amount, stake.Time)
+	offer.standings.InsertAt(stake.CustomerID, stake.Amount, stake.Time)
+	log.Printf("add in linklist%d ", stake.CustomerID)
+	return stake, lowered, nil
+}
 
+// Stakes returns up to limit stakes of the offer starting at cursor, oldest first, and
+// the cursor of the next page. Cursors stay valid as new stakes arrive.
+func (sm *StakeMap) Stakes(betOfferID int, cursor int, limit int) ([]Stake, int, bool) {
+	offer, ok := sm.Offer(betOfferID)
+	if !ok {
+		return []Stake{}, cursor, false
+	}
+	stakes, next := offer.history.page(cursor, limit)
+	return stakes, next, true
 }
-func (sm *StakeMap) GetTop(betOfferID int, maxHighStakes int) ([]string, bool) {
+
+// GetTop returns up to limit entries of the leaderboard; limit is capped at the
+// offer's depth, and 0 means the whole depth.
+func (sm *StakeMap) GetTop(betOfferID int, limit int) ([]string, bool) {
 
 	log.Printf(" betid is %d", betOfferID)
 
-	stakeMapValue, ok := sm.StakeMap.Load(betOfferID)
+	offer, ok := sm.Offer(betOfferID)
 	if !ok {
 		return make([]string, 0), false
 
 	}
 	log.Printf(" gettop")
 
-	stakeMap := stakeMapValue.(*DoublyLinkedList)
-	topStakes := stakeMap.Getlinklist(maxHighStakes)
+	topStakes := offer.list.Getlinklist(offer.limit(limit))
 	return topStakes, true
 }
+
+// TopEntries is GetTop with the placement time of every entry.
+func (sm *StakeMap) TopEntries(betOfferID int, limit int) ([]Entry, bool) {
+	offer, ok := sm.Offer(betOfferID)
+	if !ok {
+		return []Entry{}, false
+	}
+	return offer.list.Top(offer.limit(limit)), true
+}
+
+// Rank returns the customer's position and stake on the offer's leaderboard.
+func (sm *StakeMap) Rank(betOfferID int, custmerID int) (int, int, bool) {
+	offer, ok := sm.Offer(betOfferID)
+	if !ok {
+		return 0, 0, false
+	}
+	return offer.list.Rank(custmerID)
+}
@@ -0,0 +1,367 @@
+package stake
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStakeMapOfferDepth(t *testing.T) {
+	stakeMap := NewStakeMapWithDefaults(OfferConfig{Depth: 2})
+	if _, err := stakeMap.CreateOffer(1, OfferConfig{Depth: 3}); err != nil {
+		t.Fatalf("CreateOffer: %v", err)
+	}
+	if _, err := stakeMap.CreateOffer(1, OfferConfig{Depth: 5}); err != ErrOfferExists {
+		t.Errorf("Expected ErrOfferExists, got %v", err)
+	}
+	if _, err := stakeMap.CreateOffer(2, OfferConfig{}); err == nil {
+		t.Errorf("Expected error for zero depth")
+	}
+
+	for id := 1; id <= 4; id++ {
+		stakeMap.Insert(id, 1, id*10)
+		stakeMap.Insert(id, 2, id*10)
+	}
+
+	// 创建时指定的深度
+	expected := []string{"4=40", "3=30", "2=20"}
+	if actual, _ := stakeMap.GetTop(1, 0); !equal(actual, expected) {
+		t.Errorf("Expected %v, got %v", expected, actual)
+	}
+	// limit 不能超过深度
+	if actual, _ := stakeMap.GetTop(1, 10); !equal(actual, expected) {
+		t.Errorf("Expected limit capped at depth, got %v", actual)
+	}
+	if actual, _ := stakeMap.GetTop(1, 1); !equal(actual, []string{"4=40"}) {
+		t.Errorf("Expected a single entry, got %v", actual)
+	}
+	// 第一次下注自动创建的使用默认深度
+	if actual, _ := stakeMap.GetTop(2, 0); !equal(actual, []string{"4=40", "3=30"}) {
+		t.Errorf("Expected default depth, got %v", actual)
+	}
+	if _, ok := stakeMap.GetTop(3, 0); ok {
+		t.Errorf("Expected unknown offer to report false")
+	}
+}
+
+func TestStakeMapRank(t *testing.T) {
+	stakeMap := NewstakeMap()
+	if _, err := stakeMap.CreateOffer(1, OfferConfig{Depth: 1000}); err != nil {
+		t.Fatalf("CreateOffer: %v", err)
+	}
+	offer, _ := stakeMap.Offer(1)
+	if _, ok := offer.list.(*SkipList); !ok {
+		t.Errorf("Expected a deep leaderboard to use SkipList, got %T", offer.list)
+	}
+	for id := 1; id <= 100; id++ {
+		stakeMap.Insert(id, 1, id)
+		stakeMap.Insert(id, 2, id)
+	}
+	for _, betOfferID := range []int{1, 2} {
+		if rank, value, ok := stakeMap.Rank(betOfferID, 90); !ok || rank != 11 || value != 90 {
+			t.Errorf("offer %d: expected rank 11, got %d %d %t", betOfferID, rank, value, ok)
+		}
+	}
+	// 默认深度之外的客户没有排名
+	if _, _, ok := stakeMap.Rank(2, 1); ok {
+		t.Errorf("Expected customer outside the top %d to have no rank", DefaultDepth)
+	}
+}
+
+func TestStakeHistory(t *testing.T) {
+	stakeMap := NewStakeMapWithDefaults(OfferConfig{Depth: 1})
+	for i := 0; i < 5; i++ {
+		stakeMap.Place(1, Stake{CustomerID: i, Amount: 10, SessionID: "key"})
+	}
+
+	// 排行榜只留一名，历史保留所有下注
+	if top, _ := stakeMap.GetTop(1, 0); len(top) != 1 {
+		t.Errorf("Expected 1 leaderboard entry, got %v", top)
+	}
+	page, next, ok := stakeMap.Stakes(1, 0, 2)
+	if !ok || len(page) != 2 || next != 2 || page[0].CustomerID != 0 || page[1].Seq != 1 {
+		t.Fatalf("Expected first page of 2, got %v next %d", page, next)
+	}
+	if page[0].SessionID != "key" || page[0].Time.IsZero() {
+		t.Errorf("Expected session id and time recorded, got %+v", page[0])
+	}
+	page, next, _ = stakeMap.Stakes(1, next, 10)
+	if len(page) != 3 || next != 5 || page[0].Seq != 2 {
+		t.Errorf("Expected last page of 3, got %v next %d", page, next)
+	}
+
+	// cursor 在有新下注后依然有效
+	stakeMap.Insert(9, 1, 1)
+	page, next, _ = stakeMap.Stakes(1, next, 10)
+	if len(page) != 1 || page[0].CustomerID != 9 || next != 6 {
+		t.Errorf("Expected the new stake after the cursor, got %v next %d", page, next)
+	}
+	if _, _, ok := stakeMap.Stakes(2, 0, 10); ok {
+		t.Errorf("Expected unknown offer to report false")
+	}
+}
+
+func TestStakeMapMergePolicy(t *testing.T) {
+	stakeMap := NewStakeMapWithDefaults(OfferConfig{Merge: MergeSum})
+	if _, err := stakeMap.CreateOffer(1, OfferConfig{Depth: 5, Merge: MergeCount}); err != nil {
+		t.Fatalf("CreateOffer: %v", err)
+	}
+	if _, err := stakeMap.CreateOffer(3, OfferConfig{Depth: 5, Merge: "avg"}); err == nil {
+		t.Errorf("Expected unknown merge policy to be rejected")
+	}
+	for i := 0; i < 3; i++ {
+		stakeMap.Insert(7, 1, 100)
+		stakeMap.Insert(7, 2, 100)
+	}
+	if actual, _ := stakeMap.GetTop(1, 0); !equal(actual, []string{"7=3"}) {
+		t.Errorf("Expected count policy from CreateOffer, got %v", actual)
+	}
+	if actual, _ := stakeMap.GetTop(2, 0); !equal(actual, []string{"7=300"}) {
+		t.Errorf("Expected default sum policy, got %v", actual)
+	}
+}
+
+func TestOfferLifecycle(t *testing.T) {
+	stakeMap := NewstakeMap()
+	if err := stakeMap.Insert(1, 1, 100); err != nil {
+		t.Fatalf("Expected auto-created offer to accept stakes, got %v", err)
+	}
+	if _, err := stakeMap.Transition(2, OfferClosed); !errors.Is(err, ErrUnknownOffer) {
+		t.Errorf("Expected ErrUnknownOffer, got %v", err)
+	}
+
+	steps := []struct {
+		state  OfferState
+		valid  bool
+		stakes bool
+	}{
+		{OfferSuspended, true, false},
+		{OfferSettled, false, false},
+		{OfferOpen, true, true},
+		{OfferClosed, true, false},
+		{OfferOpen, false, false},
+		{OfferSettled, true, false},
+		{OfferClosed, false, false},
+	}
+	for _, step := range steps {
+		_, err := stakeMap.Transition(1, step.state)
+		if valid := err == nil; valid != step.valid {
+			t.Fatalf("Transition to %s: expected valid=%t, got %v", step.state, step.valid, err)
+		}
+		if err != nil && !errors.Is(err, ErrInvalidTransition) {
+			t.Errorf("Expected ErrInvalidTransition, got %v", err)
+		}
+		err = stakeMap.Insert(2, 1, 50)
+		if accepted := err == nil; accepted != step.stakes {
+			t.Errorf("In state %s: expected stakes accepted=%t, got %v", step.state, step.stakes, err)
+		}
+		if err != nil && !errors.Is(err, ErrOfferNotOpen) {
+			t.Errorf("Expected ErrOfferNotOpen, got %v", err)
+		}
+	}
+
+	// 结算后排行榜依然可读
+	offer, _ := stakeMap.Offer(1)
+	if offer.State() != OfferSettled {
+		t.Errorf("Expected settled offer, got %s", offer.State())
+	}
+	if actual, ok := stakeMap.GetTop(1, 0); !ok || !equal(actual, []string{"1=100", "2=50"}) {
+		t.Errorf("Expected leaderboard readable after settlement, got %v", actual)
+	}
+
+	stakeMap.AutoCreate = false
+	if err := stakeMap.Insert(1, 3, 100); !errors.Is(err, ErrUnknownOffer) {
+		t.Errorf("Expected ErrUnknownOffer without auto create, got %v", err)
+	}
+}
+
+func TestStakeLimits(t *testing.T) {
+	stakeMap := NewStakeMapWithDefaults(OfferConfig{MinStake: 10, MaxStake: 100, MaxExposure: 150})
+	stakeMap.DailyLimit = 200
+	if _, err := stakeMap.CreateOffer(2, OfferConfig{Depth: 5, MinStake: 20, MaxStake: 10}); err == nil {
+		t.Errorf("Expected min above max to be rejected")
+	}
+
+	reason := func(err error) LimitReason {
+		var limitErr *LimitError
+		if errors.As(err, &limitErr) {
+			return limitErr.Reason
+		}
+		return ""
+	}
+	steps := []struct {
+		customerID int
+		betOfferID int
+		amount     int
+		expected   LimitReason
+	}{
+		{1, 1, 0, LimitMinStake},
+		{1, 1, -5, LimitMinStake},
+		{1, 1, 5, LimitMinStake},
+		{1, 1, 101, LimitMaxStake},
+		{1, 1, 100, ""},
+		{1, 1, 60, LimitOfferExposure},
+		{1, 1, 50, ""},
+		{1, 3, 60, LimitDailyExposure}, // 被拒绝的下注不计入累计
+		{1, 3, 50, ""},
+		{2, 1, 100, ""}, // 限额按客户计算
+	}
+	for _, step := range steps {
+		err := stakeMap.Insert(step.customerID, step.betOfferID, step.amount)
+		if actual := reason(err); actual != step.expected {
+			t.Errorf("Stake %d by %d on %d: expected %q, got %v", step.amount, step.customerID, step.betOfferID, step.expected, err)
+		}
+	}
+	if stakes, _, _ := stakeMap.Stakes(1, 0, 10); len(stakes) != 3 {
+		t.Errorf("Expected rejected stakes to stay out of the history, got %v", stakes)
+	}
+
+	// 第二天重新计算每日累计
+	_, err := stakeMap.Place(4, Stake{CustomerID: 1, Amount: 100, Time: time.Now().Add(24 * time.Hour)})
+	if err != nil {
+		t.Errorf("Expected daily limit to reset the next day, got %v", err)
+	}
+}
+
+func TestCancelStake(t *testing.T) {
+	stakeMap := NewStakeMapWithDefaults(OfferConfig{Depth: 2, MaxExposure: 100})
+	stakeMap.Insert(1, 1, 100)
+	stakeMap.Insert(2, 1, 50)
+	stakeMap.Insert(3, 1, 30)
+	stakeMap.Insert(3, 1, 40)
+
+	cancelled, err := stakeMap.Cancel(1, 1)
+	if err != nil || len(cancelled) != 1 || cancelled[0].Amount != 100 {
+		t.Fatalf("Expected the stake of customer 1 cancelled, got %v %v", cancelled, err)
+	}
+	// 下一名从历史中补上
+	if actual, _ := stakeMap.GetTop(1, 0); !equal(actual, []string{"2=50", "3=40"}) {
+		t.Errorf("Expected customer 3 backfilled, got %v", actual)
+	}
+	if _, _, ok := stakeMap.Rank(1, 1); ok {
+		t.Errorf("Expected cancelled customer off the leaderboard")
+	}
+	if stakes, _, _ := stakeMap.Stakes(1, 0, 1); len(stakes) != 1 || !stakes[0].Cancelled {
+		t.Errorf("Expected the history to keep the cancelled stake, got %v", stakes)
+	}
+	if _, err := stakeMap.Cancel(1, 1); !errors.Is(err, ErrNoStake) {
+		t.Errorf("Expected ErrNoStake, got %v", err)
+	}
+
+	// 撤回后累计限额释放
+	if err := stakeMap.Insert(1, 1, 100); err != nil {
+		t.Errorf("Expected exposure released after cancel, got %v", err)
+	}
+	if actual, _ := stakeMap.GetTop(1, 0); !equal(actual, []string{"1=100", "2=50"}) {
+		t.Errorf("Expected customer 1 back on top, got %v", actual)
+	}
+
+	stakeMap.Transition(1, OfferSuspended)
+	if _, err := stakeMap.Cancel(1, 2); !errors.Is(err, ErrOfferNotOpen) {
+		t.Errorf("Expected ErrOfferNotOpen, got %v", err)
+	}
+	if _, err := stakeMap.Cancel(9, 2); !errors.Is(err, ErrUnknownOffer) {
+		t.Errorf("Expected ErrUnknownOffer, got %v", err)
+	}
+}
+
+func TestCancelBackfill(t *testing.T) {
+	// 累计模式下补位的客户带着自己的累计值
+	sum := NewStakeMapWithDefaults(OfferConfig{Depth: 2, Merge: MergeSum})
+	sum.Insert(1, 1, 100)
+	sum.Insert(2, 1, 50)
+	sum.Insert(3, 1, 30)
+	sum.Insert(3, 1, 30)
+	sum.Cancel(1, 1)
+	if actual, _ := sum.GetTop(1, 0); !equal(actual, []string{"3=60", "2=50"}) {
+		t.Errorf("Expected customer 2 backfilled with their total, got %v", actual)
+	}
+	sum.Insert(2, 1, 20)
+	if actual, _ := sum.GetTop(1, 0); !equal(actual, []string{"2=70", "3=60"}) {
+		t.Errorf("Expected the backfilled total to keep adding up, got %v", actual)
+	}
+
+	// 补位的客户排在同样金额的客户后面
+	ties := NewStakeMapWithDefaults(OfferConfig{Depth: 2, Ties: TieLastCome})
+	ties.Insert(1, 1, 100)
+	ties.Insert(2, 1, 50)
+	ties.Insert(3, 1, 50)
+	ties.Cancel(1, 1)
+	if actual, _ := ties.GetTop(1, 0); !equal(actual, []string{"3=50", "2=50"}) {
+		t.Errorf("Expected the backfilled customer below the tie, got %v", actual)
+	}
+
+	// 不在排行榜上的客户撤回，排行榜不变，之后也不会被补回来
+	offList := NewStakeMapWithDefaults(OfferConfig{Depth: 1})
+	offList.Insert(1, 1, 100)
+	offList.Insert(2, 1, 50)
+	offList.Cancel(1, 2)
+	if actual, _ := offList.GetTop(1, 0); !equal(actual, []string{"1=100"}) {
+		t.Errorf("Expected the leaderboard unchanged, got %v", actual)
+	}
+	offList.Cancel(1, 1)
+	if actual, _ := offList.GetTop(1, 0); len(actual) != 0 {
+		t.Errorf("Expected no cancelled customer backfilled, got %v", actual)
+	}
+
+	// SkipList 上连续补位的客户金额相同，排名和删除依然正确
+	lastCome := NewStakeMapWithDefaults(OfferConfig{Depth: 65, Ties: TieLastCome})
+	for i := 0; i < 70; i++ {
+		lastCome.Insert(i, 1, 100)
+	}
+	for _, id := range []int{69, 68, 67, 66, 65, 4, 2, 0} { // 4、2、0 是补位上来的
+		if _, err := lastCome.Cancel(1, id); err != nil {
+			t.Fatalf("Cancel %d: %v", id, err)
+		}
+	}
+	expected := make([]string, 0, 62)
+	for i := 64; i >= 5; i-- {
+		expected = append(expected, fmt.Sprintf("%d=100", i))
+	}
+	expected = append(expected, "3=100", "1=100")
+	if actual, _ := lastCome.GetTop(1, 0); !equal(actual, expected) {
+		t.Errorf("Expected backfills to rank last in standings order, got %v", actual)
+	}
+	for rank, entry := range expected {
+		var id int
+		fmt.Sscanf(entry, "%d=", &id)
+		if actual, _, ok := lastCome.Rank(1, id); !ok || actual != rank+1 {
+			t.Errorf("Expected customer %d at rank %d, got %d %t", id, rank+1, actual, ok)
+		}
+	}
+
+	// 深排行榜用 SkipList
+	deep := NewStakeMapWithDefaults(OfferConfig{Depth: 100})
+	for i := 0; i <= 100; i++ {
+		deep.Insert(i, 1, 1000-i)
+	}
+	deep.Cancel(1, 0)
+	if rank, value, ok := deep.Rank(1, 100); !ok || rank != 100 || value != 900 {
+		t.Errorf("Expected customer 100 backfilled last, got %d %d %t", rank, value, ok)
+	}
+}
+
+func TestCancelConcurrentWithStakes(t *testing.T) {
+	stakeMap := NewStakeMapWithDefaults(OfferConfig{Depth: 5})
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			for j := 1; j <= 20; j++ {
+				stakeMap.Insert(id, 1, j)
+				stakeMap.GetTop(1, 0)
+				if j%5 == 0 {
+					stakeMap.Cancel(1, id)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	// 每个客户最后一次撤回之后没有再下注
+	if actual, _ := stakeMap.GetTop(1, 0); len(actual) != 0 {
+		t.Errorf("Expected an empty leaderboard, got %v", actual)
+	}
+}
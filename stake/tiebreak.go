@@ -0,0 +1,66 @@
+package stake
+
+import (
+	"fmt"
+	"time"
+)
+
+// TieBreak orders customers whose leaderboard values are equal, by when they reached that value.
+type TieBreak string
+
+const (
+	TieFirstCome TieBreak = "first" // 先到的排在前面，默认
+	TieLastCome  TieBreak = "last"  // 后到的排在前面
+)
+
+func ParseTieBreak(ties string) (TieBreak, error) {
+	switch TieBreak(ties) {
+	case "", TieFirstCome:
+		return TieFirstCome, nil
+	case TieLastCome:
+		return TieLastCome, nil
+	}
+	return TieFirstCome, fmt.Errorf("unknown tie break %q", ties)
+}
+
+// Entry is one leaderboard position.
+type Entry struct {
+	ID     int       `json:"customer_id"`
+	Value  int       `json:"value"`
+	Seq    int64     `json:"seq"`    // 在排行榜上的更新顺序，补位的客户在 TieLastCome 下为负数
+	Placed time.Time `json:"placed"` // 让客户达到当前值的那次下注的时间
+}
+
+// sequence hands out the seqs of a leaderboard. Every seq is unique, so (value, seq)
+// orders the list strictly.
+type sequence struct {
+	last     int64
+	trailing int64 // 补位用的 seq，从 0 往下数
+}
+
+func (s *sequence) next() int64 {
+	s.last++
+	return s.last
+}
+
+// trailingFor returns a seq that ranks below every equal value already on the list,
+// including earlier backfills. The last to come ranks first under TieLastCome, so
+// there the seqs count down from 0 instead.
+func (s *sequence) trailingFor(t TieBreak) int64 {
+	if t == TieLastCome {
+		s.trailing--
+		return s.trailing
+	}
+	return s.next()
+}
+
+// ranksBefore reports whether a customer with value and seq a ranks ahead of b.
+func (t TieBreak) ranksBefore(aValue int, aSeq int64, bValue int, bSeq int64) bool {
+	if aValue != bValue {
+		return aValue > bValue
+	}
+	if t == TieLastCome {
+		return aSeq > bSeq
+	}
+	return aSeq < bSeq
+}